@@ -0,0 +1,65 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock carries the data of the clock synchronisation between server and worker
+type Clock struct {
+	// Time is the server time when it answered a ping
+	Time time.Time
+	// Offset is the estimated difference of the server clock to the worker clock
+	Offset time.Duration `json:",omitempty"`
+	// RoundTrip is the round trip time of the ping the offset was estimated with
+	RoundTrip time.Duration `json:",omitempty"`
+}
+
+// Schedule tells the workers when to start and stop a test. Both times
+// are in server clock - StopAt is zero for tests that end after a number
+// of operations
+type Schedule struct {
+	StartAt time.Time
+	StopAt  time.Time
+}
+
+// ClockSyncRounds is the number of pings used to estimate the clock offset
+const ClockSyncRounds = 5
+
+// SyncClock estimates the offset of the server clock to our clock by
+// sending pings to the server. The estimate of the ping with the shortest
+// round trip is used, as its timestamp is the least distorted one.
+// Add the offset to a local time to get the server time
+func (c *Connection) SyncClock(rounds int) (Clock, error) {
+	var best Clock
+	for round := 0; round < rounds; round++ {
+		sent := time.Now()
+		if err := c.Send(WorkerMessage{Kind: MessagePing}); err != nil {
+			return best, err
+		}
+		message, err := c.Expect(MessagePong)
+		if err != nil {
+			return best, err
+		}
+		received := time.Now()
+		if message.Clock == nil {
+			return best, fmt.Errorf("pong without server time")
+		}
+		roundTrip := received.Sub(sent)
+		if round == 0 || roundTrip < best.RoundTrip {
+			// The server time is taken halfway between sending and receiving.
+			// Round(0) strips the monotonic clock, so that wall clocks are compared
+			midway := sent.Add(roundTrip / 2).Round(0)
+			best = Clock{
+				Offset:    message.Clock.Time.Sub(midway),
+				RoundTrip: roundTrip,
+			}
+		}
+	}
+	return best, nil
+}
+
+// Pong answers a ping of the worker with the current server time
+func (c *Connection) Pong() error {
+	return c.Send(WorkerMessage{Kind: MessagePong, Clock: &Clock{Time: time.Now()}})
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyncClock(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration
+	}{
+		{"same clock", 0},
+		{"server ahead", time.Hour},
+		{"server behind", -90 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, worker := pipe(t)
+			go func() {
+				for round := 0; round < ClockSyncRounds; round++ {
+					if _, err := server.Expect(MessagePing); err != nil {
+						return
+					}
+					_ = server.Send(WorkerMessage{Kind: MessagePong, Clock: &Clock{Time: time.Now().Add(tt.offset)}})
+				}
+			}()
+
+			clock, err := worker.SyncClock(ClockSyncRounds)
+			if err != nil {
+				t.Fatalf("SyncClock() error = %v", err)
+			}
+			if diff := clock.Offset - tt.offset; diff > clock.RoundTrip || diff < -clock.RoundTrip {
+				t.Errorf("SyncClock() offset = %v, want %v within the round trip of %v", clock.Offset, tt.offset, clock.RoundTrip)
+			}
+		})
+	}
+}
+
+func TestSyncClockWithoutTime(t *testing.T) {
+	server, worker := pipe(t)
+	go func() {
+		if _, err := server.Expect(MessagePing); err == nil {
+			_ = server.Send(WorkerMessage{Kind: MessagePong})
+		}
+	}()
+	if _, err := worker.SyncClock(1); err == nil {
+		t.Errorf("SyncClock() expected an error for a pong without server time")
+	}
+}
@@ -25,14 +25,36 @@ const (
 )
 
 // S3Configuration contains all information to connect to a certain S3 endpoint
+// Several endpoints (e.g. multiple RGW gateways) can be given via Endpoints -
+// the parallel clients of a worker then spread their requests across them
+// according to LoadBalancing
 type S3Configuration struct {
 	AccessKey     string        `yaml:"access_key" json:"access_key"`
 	SecretKey     string        `yaml:"secret_key" json:"secret_key"`
 	Region        string        `yaml:"region" json:"region"`
 	Endpoint      string        `yaml:"endpoint" json:"endpoint"`
+	Endpoints     []string      `yaml:"endpoints" json:"endpoints"`
+	LoadBalancing string        `yaml:"load_balancing" json:"load_balancing"`
 	Timeout       time.Duration `yaml:"timeout" json:"timeout"`
 	SkipSSLVerify bool          `yaml:"skipSSLverify" json:"skipSSLverify"`
 	UsePathStyle  bool          `yaml:"usePathStyle" json:"usePathStyle"`
+	// WorkerSelector restricts this S3 config to workers with matching labels
+	WorkerSelector map[string]string `yaml:"worker_selector" json:"worker_selector"`
+}
+
+// EndpointList returns all endpoints of this S3 config - the single
+// endpoint first, followed by the ones from the endpoints list
+func (c *S3Configuration) EndpointList() []string {
+	var endpoints []string
+	seen := map[string]bool{}
+	for _, endpoint := range append([]string{c.Endpoint}, c.Endpoints...) {
+		if endpoint == "" || seen[endpoint] {
+			continue
+		}
+		seen[endpoint] = true
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
 }
 
 // GrafanaConfiguration contains all information necessary to add annotations
@@ -77,6 +99,149 @@ type TestCaseConfiguration struct {
 	WriteWeight        int      `yaml:"write_weight" json:"write_weight"`
 	ListWeight         int      `yaml:"list_weight" json:"list_weight"`
 	DeleteWeight       int      `yaml:"delete_weight" json:"delete_weight"`
+	// Warmup and Cooldown run load before and after the measured part of
+	// the test - operations in these windows are not part of the results
+	Warmup   Duration `yaml:"warmup" json:"warmup"`
+	Cooldown Duration `yaml:"cooldown" json:"cooldown"`
+	// WorkerSelector restricts this test to workers with matching labels
+	WorkerSelector map[string]string `yaml:"worker_selector" json:"worker_selector"`
+	// Timeline configures the per-interval measurements of the test
+	Timeline struct {
+		Interval     Duration `yaml:"interval" json:"interval"`
+		ExcludeStart Duration `yaml:"exclude_start" json:"exclude_start"`
+		ExcludeEnd   Duration `yaml:"exclude_end" json:"exclude_end"`
+	} `yaml:"timeline" json:"timeline"`
+	// Assert contains the thresholds the test needs to meet to pass
+	Assert Assertions `yaml:"assert" json:"assert"`
+	// PrepareClients is the number of parallel uploads during the
+	// preparation - parallel_clients is used if it is not set
+	PrepareClients int `yaml:"prepare_clients" json:"prepare_clients"`
+	// Dataset is the name of the dataset the test works on. The objects and
+	// buckets of the test are ignored then
+	Dataset string `yaml:"dataset" json:"dataset"`
+	// DatasetConfig is the dataset named by Dataset - set when checking the config
+	DatasetConfig *Dataset `yaml:"-" json:"dataset_config,omitempty"`
+	// Mode is one of the Mode constants - by default a test prepares its
+	// objects, runs the workload and optionally cleans up
+	Mode string `yaml:"mode" json:"mode"`
+	// Versioning is set on the buckets of the test when they are created -
+	// VersioningEnabled or empty
+	Versioning string `yaml:"versioning" json:"versioning"`
+	// The version operations work on version chains of the same object and
+	// need buckets with versioning enabled
+	VersionWriteWeight  int `yaml:"version_write_weight" json:"version_write_weight"`
+	VersionReadWeight   int `yaml:"version_read_weight" json:"version_read_weight"`
+	VersionDeleteWeight int `yaml:"version_delete_weight" json:"version_delete_weight"`
+	VersionListWeight   int `yaml:"version_list_weight" json:"version_list_weight"`
+	// VersionsPerObject is the number of versions that are prepared for the
+	// objects of the version read, delete and list operations
+	VersionsPerObject int `yaml:"versions_per_object" json:"versions_per_object"`
+	// OverwriteWeight rewrites prepared objects in place
+	OverwriteWeight int `yaml:"overwrite_weight" json:"overwrite_weight"`
+	// OverwriteSizeChange is the maximum relative size change of an
+	// overwrite - 0.5 rewrites objects with 50% to 150% of their size
+	OverwriteSizeChange float64 `yaml:"overwrite_size_change" json:"overwrite_size_change"`
+	// The metadata operations work on prepared objects
+	PutTaggingWeight int `yaml:"put_tagging_weight" json:"put_tagging_weight"`
+	GetTaggingWeight int `yaml:"get_tagging_weight" json:"get_tagging_weight"`
+	CopyWeight       int `yaml:"copy_weight" json:"copy_weight"`
+	PutACLWeight     int `yaml:"put_acl_weight" json:"put_acl_weight"`
+	GetACLWeight     int `yaml:"get_acl_weight" json:"get_acl_weight"`
+	// HeadWeight reads the metadata of an object with HeadObject
+	HeadWeight int `yaml:"head_weight" json:"head_weight"`
+	// TagsPerObject is the number of tags put_tagging_weight sets
+	TagsPerObject int `yaml:"tags_per_object" json:"tags_per_object"`
+	// Metadata is attached to every uploaded and copied object as user metadata
+	Metadata struct {
+		Count int `yaml:"count" json:"count"`
+		// Size is the length of every metadata value in bytes
+		Size int `yaml:"size" json:"size"`
+	} `yaml:"metadata" json:"metadata"`
+	// List configures what the list operations list
+	List struct {
+		// Mode is one of the ListMode constants - ListModePrefix by default
+		Mode string `yaml:"mode" json:"mode"`
+		// MaxKeys is the page size of the listings - 0 uses the default of the server
+		MaxKeys int32 `yaml:"max_keys" json:"max_keys"`
+		// Version selects ListObjects (1) or ListObjectsV2 (2, default)
+		Version int `yaml:"version" json:"version"`
+		// Delimiter, Depth and Fanout describe the directory tree of the
+		// objects in ListModeDirectory
+		Delimiter string `yaml:"delimiter" json:"delimiter"`
+		Depth     int    `yaml:"depth" json:"depth"`
+		Fanout    int    `yaml:"fanout" json:"fanout"`
+		// PrefixDepth is the number of directories in the prefix of every listing
+		PrefixDepth int `yaml:"prefix_depth" json:"prefix_depth"`
+	} `yaml:"list" json:"list"`
+	// KeyTemplate names the objects of the test - workerID, object_prefix
+	// and index by default
+	KeyTemplate KeyTemplate `yaml:"key_template" json:"key_template"`
+	// Encryption configures the server-side encryption of the objects
+	Encryption Encryption `yaml:"encryption" json:"encryption"`
+}
+
+// Modes of the list operations
+const (
+	// ListModePrefix lists with the name of the object as prefix
+	ListModePrefix = "prefix"
+	// ListModeFull lists the whole bucket page by page
+	ListModeFull = "full"
+	// ListModeDirectory lists a directory of hierarchical object names with a delimiter
+	ListModeDirectory = "directory"
+)
+
+// MaxTagsPerObject is the maximum number of tags S3 allows on an object
+const MaxTagsPerObject = 10
+
+// VersioningEnabled enables versioning on the buckets of a test
+const VersioningEnabled = "enabled"
+
+// Modes of a test
+const (
+	// ModePrepare only creates the buckets and objects of a test
+	ModePrepare = "prepare"
+	// ModeRun only runs the workload - the objects need to exist already
+	ModeRun = "run"
+	// ModeCleanup only deletes the buckets and objects of a test
+	ModeCleanup = "cleanup"
+)
+
+// totalWeight returns the sum of the weights of all operations
+func (t *TestCaseConfiguration) totalWeight() int {
+	return t.ReadWeight + t.ExistingReadWeight + t.WriteWeight + t.ListWeight + t.DeleteWeight +
+		t.OverwriteWeight + t.versionWeight() + t.metadataWeight()
+}
+
+// versionWeight returns the sum of the weights of all version operations
+func (t *TestCaseConfiguration) versionWeight() int {
+	return t.VersionWriteWeight + t.VersionReadWeight + t.VersionDeleteWeight + t.VersionListWeight
+}
+
+// metadataWeight returns the sum of the weights of all metadata operations
+func (t *TestCaseConfiguration) metadataWeight() int {
+	return t.PutTaggingWeight + t.GetTaggingWeight + t.CopyWeight + t.PutACLWeight + t.GetACLWeight + t.HeadWeight
+}
+
+// RunsWorkload returns whether the test has a measured phase
+func (t *TestCaseConfiguration) RunsWorkload() bool {
+	return t.Mode == "" || t.Mode == ModeRun
+}
+
+// Assertions are thresholds that the aggregated results of a test are
+// checked against. Thresholds that are not set are not checked
+type Assertions struct {
+	MinOpsPerSecond float64 `yaml:"min_ops_per_second" json:"min_ops_per_second"`
+	MinMiBPerSecond float64 `yaml:"min_mib_per_second" json:"min_mib_per_second"`
+	// MaxP99Latency maps a method (GET, PUT, LIST, DELETE) or TOTAL to
+	// the maximum p99 latency in ms
+	MaxP99Latency map[string]float64 `yaml:"max_p99_latency" json:"max_p99_latency"`
+	// MaxErrorRate is the maximum fraction of failed operations (0.01 = 1%)
+	MaxErrorRate *float64 `yaml:"max_error_rate" json:"max_error_rate"`
+}
+
+// IsEmpty returns true when no assertion is set
+func (a *Assertions) IsEmpty() bool {
+	return a.MinOpsPerSecond == 0 && a.MinMiBPerSecond == 0 && len(a.MaxP99Latency) == 0 && a.MaxErrorRate == nil
 }
 
 // Testconf contains all the information necessary to set up a distributed test
@@ -84,6 +249,7 @@ type Testconf struct {
 	S3Config      []*S3Configuration       `yaml:"s3_config" json:"s3_config"`
 	GrafanaConfig *GrafanaConfiguration    `yaml:"grafana_config" json:"grafana_config"`
 	Tests         []*TestCaseConfiguration `yaml:"tests" json:"tests"`
+	Datasets      []*Dataset               `yaml:"datasets" json:"datasets"`
 }
 
 // WorkerConf is the configuration that is sent to each worker
@@ -92,31 +258,55 @@ type WorkerConf struct {
 	S3Config *S3Configuration
 	Test     *TestCaseConfiguration
 	WorkerID string
+	// WorkerIndex is the number of the worker within its test
+	WorkerIndex int
+	// ProgressInterval determines how often the worker reports its progress
+	// during the test. 0 disables progress reports
+	ProgressInterval time.Duration
 }
 
 // BenchResult is the struct that will contain the benchmark results from a
 // worker after it has finished its benchmark
 type BenchmarkResult struct {
 	TestName   string
+	WorkerID   string `json:",omitempty"`
 	Operations float64
 	Bytes      float64
 	// Bandwidth is the amount of Bytes per second of runtime
 	Bandwidth  float64
 	LatencyAvg float64
+	LatencyP50 float64
+	LatencyP90 float64
+	LatencyP99 float64
 	Duration   time.Duration
-}
-
-// WorkerMessage is the struct that is exchanged in the communication between
-// server and worker. It usually only contains a message, but during the init
-// phase, also contains the config for the worker
-type WorkerMessage struct {
-	Message     string
-	Config      *WorkerConf
-	BenchResult BenchmarkResult
+	// FairnessIndex is Jain's fairness index of the operations of all workers
+	FairnessIndex float64 `json:",omitempty"`
+	// ClockOffset is the estimated offset of the server clock to the worker clock
+	ClockOffset time.Duration `json:",omitempty"`
+	// Timeline contains the measurements per interval of the test
+	Timeline []*IntervalStats `json:",omitempty"`
+	// Preparation describes the upload of the objects before the test
+	Preparation *PrepStats `json:",omitempty"`
+	// Aborted is set when the test was stopped before its end - the
+	// results only cover the time until the abort then
+	Aborted bool `json:",omitempty"`
+	// Cleanup describes the deletion of the objects in tests with mode cleanup
+	Cleanup *PrepStats `json:",omitempty"`
+	// Encryption is the server-side encryption mode of the test
+	Encryption string `json:",omitempty"`
 }
 
 // CheckConfig checks the global config
 func CheckConfig(config *Testconf) {
+	for _, s3Config := range config.S3Config {
+		err := checkS3Config(s3Config)
+		if err != nil {
+			log.WithError(err).Fatalf("Issue detected when scanning through the config file:")
+		}
+	}
+	if err := checkDatasets(config); err != nil {
+		log.WithError(err).Fatalf("Issue detected when scanning through the config file:")
+	}
 	for _, testcase := range config.Tests {
 		// log.Debugf("Checking testcase with prefix %s", testcase.BucketPrefix)
 		err := checkTestCase(testcase)
@@ -124,18 +314,217 @@ func CheckConfig(config *Testconf) {
 			log.WithError(err).Fatalf("Issue detected when scanning through the config file:")
 		}
 	}
+	if err := checkCustomerKeys(config); err != nil {
+		log.WithError(err).Fatalf("Issue detected when scanning through the config file:")
+	}
+}
+
+func checkS3Config(s3Config *S3Configuration) error {
+	if len(s3Config.EndpointList()) == 0 {
+		return fmt.Errorf("Either endpoint or endpoints needs to be set in the S3 config")
+	}
+	switch s3Config.LoadBalancing {
+	case "", "round-robin", "random", "least-outstanding":
+		return nil
+	}
+	return fmt.Errorf("%s is not a valid load_balancing. Allowed options are round-robin, random, least-outstanding", s3Config.LoadBalancing)
 }
 
 func checkTestCase(testcase *TestCaseConfiguration) error {
+	switch testcase.Mode {
+	case "", ModeRun:
+	case ModePrepare, ModeCleanup:
+		return checkDataTestCase(testcase)
+	default:
+		return fmt.Errorf("Unknown mode %s - use %s, %s or %s", testcase.Mode, ModePrepare, ModeRun, ModeCleanup)
+	}
 	if testcase.Runtime == 0 && testcase.OpsDeadline == 0 {
 		return fmt.Errorf("Either stop_with_runtime or stop_with_ops needs to be set")
 	}
-	if testcase.ReadWeight == 0 && testcase.WriteWeight == 0 && testcase.ListWeight == 0 && testcase.DeleteWeight == 0 && testcase.ExistingReadWeight == 0 {
+	if testcase.totalWeight() == 0 {
 		return fmt.Errorf("At least one weight needs to be set - Read / Write / List / Delete")
 	}
+	if err := checkVersioning(testcase); err != nil {
+		return err
+	}
+	if testcase.OverwriteSizeChange < 0 || testcase.OverwriteSizeChange > 1 {
+		return fmt.Errorf("The overwrite_size_change needs to be between 0 and 1")
+	}
+	if err := checkMetadata(testcase); err != nil {
+		return err
+	}
+	if err := checkList(testcase); err != nil {
+		return err
+	}
+	if err := checkKeyTemplate(testcase); err != nil {
+		return err
+	}
+	if err := checkEncryption(testcase); err != nil {
+		return err
+	}
 	if testcase.ExistingReadWeight != 0 && testcase.BucketPrefix == "" {
 		return fmt.Errorf("When using existing_read_weight, setting the bucket_prefix is mandatory")
 	}
+	if testcase.DatasetConfig != nil {
+		if testcase.ExistingReadWeight != 0 {
+			return fmt.Errorf("When using a dataset, existing_read_weight can not be set - use read_weight instead")
+		}
+		if testcase.CleanAfter {
+			return fmt.Errorf("When using a dataset, clean_after can not be set - the dataset is kept for later tests")
+		}
+		if testcase.DeleteWeight != 0 {
+			return fmt.Errorf("When using a dataset, delete_weight can not be set - the dataset is kept for later tests")
+		}
+		if testcase.versionWeight() != 0 {
+			return fmt.Errorf("When using a dataset, version operations can not be used")
+		}
+		if testcase.OverwriteSizeChange != 0 {
+			return fmt.Errorf("When using a dataset, overwrite_size_change can not be set - the objects of the dataset need to keep their size")
+		}
+		if testcase.List.Mode == ListModeDirectory {
+			return fmt.Errorf("When using a dataset, the list mode can not be %s - the objects of a dataset are not hierarchical", ListModeDirectory)
+		}
+	} else if err := checkTestObjects(testcase); err != nil {
+		return err
+	}
+	if testcase.PrepareClients < 0 {
+		return fmt.Errorf("The number of prepare_clients must not be negative")
+	}
+	if testcase.Warmup < 0 || testcase.Cooldown < 0 {
+		return fmt.Errorf("Warmup and cooldown must not be negative")
+	}
+	if testcase.Cooldown != 0 && testcase.Runtime == 0 {
+		return fmt.Errorf("A cooldown can only be used together with stop_with_runtime")
+	}
+	if testcase.Timeline.Interval < 0 || testcase.Timeline.ExcludeStart < 0 || testcase.Timeline.ExcludeEnd < 0 {
+		return fmt.Errorf("Timeline durations must not be negative")
+	}
+	if testcase.Timeline.Interval == 0 {
+		testcase.Timeline.Interval = Duration(time.Second)
+	}
+	if testcase.Runtime != 0 && testcase.Timeline.ExcludeStart+testcase.Timeline.ExcludeEnd >= testcase.Runtime {
+		return fmt.Errorf("The excluded timeline windows must be shorter than stop_with_runtime")
+	}
+	if err := checkAssertions(&testcase.Assert); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkDataTestCase checks tests that only prepare or clean up objects
+func checkDataTestCase(testcase *TestCaseConfiguration) error {
+	if testcase.CleanAfter {
+		return fmt.Errorf("When using mode %s, clean_after can not be set", testcase.Mode)
+	}
+	if !testcase.Assert.IsEmpty() {
+		return fmt.Errorf("When using mode %s, there are no results to assert", testcase.Mode)
+	}
+	if testcase.PrepareClients < 0 {
+		return fmt.Errorf("The number of prepare_clients must not be negative")
+	}
+	if err := checkVersioning(testcase); err != nil {
+		return err
+	}
+	if err := checkMetadata(testcase); err != nil {
+		return err
+	}
+	if err := checkKeyTemplate(testcase); err != nil {
+		return err
+	}
+	if err := checkEncryption(testcase); err != nil {
+		return err
+	}
+	if testcase.DatasetConfig != nil {
+		return nil
+	}
+	if testcase.Mode == ModeCleanup {
+		if testcase.BucketPrefix == "" {
+			return fmt.Errorf("When using mode cleanup, setting the bucket_prefix is mandatory")
+		}
+		return nil
+	}
+	return checkTestObjects(testcase)
+}
+
+func checkVersioning(testcase *TestCaseConfiguration) error {
+	switch testcase.Versioning {
+	case "", VersioningEnabled:
+	default:
+		return fmt.Errorf("Unknown bucket versioning %s - use %s or leave it empty", testcase.Versioning, VersioningEnabled)
+	}
+	if testcase.versionWeight() != 0 && testcase.Versioning != VersioningEnabled {
+		return fmt.Errorf("When using version operations, the versioning of the buckets needs to be %s", VersioningEnabled)
+	}
+	if testcase.Mode == ModeRun && (testcase.VersionReadWeight != 0 || testcase.VersionDeleteWeight != 0) {
+		return fmt.Errorf("When using mode %s, version_read_weight and version_delete_weight can not be set - their versions are uploaded during the preparation", ModeRun)
+	}
+	if testcase.VersionsPerObject < 0 {
+		return fmt.Errorf("The number of versions_per_object must not be negative")
+	}
+	if testcase.VersionsPerObject == 0 {
+		testcase.VersionsPerObject = 1
+	}
+	return nil
+}
+
+func checkMetadata(testcase *TestCaseConfiguration) error {
+	if testcase.TagsPerObject < 0 || testcase.TagsPerObject > MaxTagsPerObject {
+		return fmt.Errorf("The number of tags_per_object needs to be between 0 and %d", MaxTagsPerObject)
+	}
+	if testcase.TagsPerObject == 0 {
+		testcase.TagsPerObject = 1
+	}
+	if testcase.Metadata.Count < 0 || testcase.Metadata.Size < 0 {
+		return fmt.Errorf("The metadata count and size must not be negative")
+	}
+	return nil
+}
+
+func checkList(testcase *TestCaseConfiguration) error {
+	list := &testcase.List
+	switch list.Mode {
+	case "":
+		list.Mode = ListModePrefix
+	case ListModePrefix, ListModeFull, ListModeDirectory:
+	default:
+		return fmt.Errorf("Unknown list mode %s - use %s, %s or %s", list.Mode, ListModePrefix, ListModeFull, ListModeDirectory)
+	}
+	switch list.Version {
+	case 0:
+		list.Version = 2
+	case 1, 2:
+	default:
+		return fmt.Errorf("The list version needs to be 1 or 2")
+	}
+	if list.MaxKeys < 0 || list.MaxKeys > 1000 {
+		return fmt.Errorf("The list max_keys needs to be between 0 and 1000")
+	}
+	if list.Mode != ListModeDirectory {
+		return nil
+	}
+	if list.Delimiter == "" {
+		list.Delimiter = "/"
+	}
+	if list.Depth == 0 {
+		list.Depth = 2
+	}
+	if list.Fanout == 0 {
+		list.Fanout = 10
+	}
+	if list.PrefixDepth == 0 {
+		list.PrefixDepth = 1
+	}
+	if list.Depth < 0 || list.Fanout < 0 || list.PrefixDepth < 0 {
+		return fmt.Errorf("The list depth, fanout and prefix_depth must not be negative")
+	}
+	if list.PrefixDepth > list.Depth {
+		return fmt.Errorf("The list prefix_depth can not be larger than the depth of the directory tree")
+	}
+	return nil
+}
+
+// checkTestObjects checks the objects and buckets of a test that does not use a dataset
+func checkTestObjects(testcase *TestCaseConfiguration) error {
 	if testcase.Buckets.NumberMin == 0 {
 		return fmt.Errorf("Please set minimum number of Buckets")
 	}
@@ -160,26 +549,51 @@ func checkTestCase(testcase *TestCaseConfiguration) error {
 	if testcase.Objects.Unit == "" {
 		return fmt.Errorf("Please set the Objects unit")
 	}
+	toByteMultiplicator, err := unitMultiplicator(testcase.Objects.Unit)
+	if err != nil {
+		return err
+	}
+	testcase.Objects.SizeMin = testcase.Objects.SizeMin * toByteMultiplicator
+	testcase.Objects.SizeMax = testcase.Objects.SizeMax * toByteMultiplicator
+	testcase.Objects.PartSize = testcase.Objects.PartSize * toByteMultiplicator
+	return nil
+}
 
-	var toByteMultiplicator uint64
-	switch strings.ToUpper(testcase.Objects.Unit) {
+// unitMultiplicator returns the number of bytes of one unit (B/KB/MB/GB/TB)
+func unitMultiplicator(unit string) (uint64, error) {
+	switch strings.ToUpper(unit) {
 	case "B":
-		toByteMultiplicator = BYTE
+		return BYTE, nil
 	case "KB", "K":
-		toByteMultiplicator = KILOBYTE
+		return KILOBYTE, nil
 	case "MB", "M":
-		toByteMultiplicator = MEGABYTE
+		return MEGABYTE, nil
 	case "GB", "G":
-		toByteMultiplicator = GIGABYTE
+		return GIGABYTE, nil
 	case "TB", "T":
-		toByteMultiplicator = TERABYTE
-	default:
-		return fmt.Errorf("Could not parse unit size - please use one of B/KB/MB/GB/TB")
+		return TERABYTE, nil
 	}
+	return 0, fmt.Errorf("Could not parse unit size - please use one of B/KB/MB/GB/TB")
+}
 
-	testcase.Objects.SizeMin = testcase.Objects.SizeMin * toByteMultiplicator
-	testcase.Objects.SizeMax = testcase.Objects.SizeMax * toByteMultiplicator
-	testcase.Objects.PartSize = testcase.Objects.PartSize * toByteMultiplicator
+func checkAssertions(assert *Assertions) error {
+	if assert.MinOpsPerSecond < 0 || assert.MinMiBPerSecond < 0 {
+		return fmt.Errorf("The assert thresholds must not be negative")
+	}
+	if assert.MaxErrorRate != nil && (*assert.MaxErrorRate < 0 || *assert.MaxErrorRate > 1) {
+		return fmt.Errorf("The assert max_error_rate needs to be between 0 and 1")
+	}
+	latencies := make(map[string]float64, len(assert.MaxP99Latency))
+	for method, latency := range assert.MaxP99Latency {
+		method = strings.ToUpper(method)
+		if latency <= 0 {
+			return fmt.Errorf("The assert max_p99_latency of %s needs to be positive", method)
+		}
+		latencies[method] = latency
+	}
+	if len(latencies) > 0 {
+		assert.MaxP99Latency = latencies
+	}
 	return nil
 }
 
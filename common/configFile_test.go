@@ -278,6 +278,341 @@ func Test_checkTestCase(t *testing.T) {
 	}
 }
 
+func validTestCase() *TestCaseConfiguration {
+	testcase := &TestCaseConfiguration{Runtime: Duration(10 * time.Second), OpsDeadline: 10, ReadWeight: 1}
+	testcase.Buckets.NumberMin = 1
+	testcase.Buckets.NumberDistribution = "constant"
+	testcase.Objects.SizeMin = 1
+	testcase.Objects.SizeMax = 2
+	testcase.Objects.NumberMin = 3
+	testcase.Objects.SizeDistribution = "constant"
+	testcase.Objects.NumberDistribution = "constant"
+	testcase.Objects.Unit = "KB"
+	return testcase
+}
+
+func Test_checkTestCaseTimeline(t *testing.T) {
+	tests := []struct {
+		name         string
+		interval     Duration
+		excludeStart Duration
+		excludeEnd   Duration
+		wantInterval Duration
+		wantErr      bool
+	}{
+		{"Default interval", 0, 0, 0, Duration(time.Second), false},
+		{"Custom interval", Duration(5 * time.Second), 0, 0, Duration(5 * time.Second), false},
+		{"Exclude warm-up and cool-down", 0, Duration(2 * time.Second), Duration(3 * time.Second), Duration(time.Second), false},
+		{"Negative interval", Duration(-time.Second), 0, 0, 0, true},
+		{"Negative exclusion", 0, Duration(-time.Second), 0, 0, true},
+		{"Exclusion longer than runtime", 0, Duration(5 * time.Second), Duration(5 * time.Second), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			testcase.Timeline.Interval = tt.interval
+			testcase.Timeline.ExcludeStart = tt.excludeStart
+			testcase.Timeline.ExcludeEnd = tt.excludeEnd
+			err := checkTestCase(testcase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkTestCase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && testcase.Timeline.Interval != tt.wantInterval {
+				t.Errorf("checkTestCase() interval = %v, want %v", testcase.Timeline.Interval, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func Test_checkTestCaseWarmup(t *testing.T) {
+	tests := []struct {
+		name     string
+		runtime  Duration
+		ops      uint64
+		warmup   Duration
+		cooldown Duration
+		wantErr  bool
+	}{
+		{"Warmup and cooldown with runtime", Duration(10 * time.Second), 0, Duration(5 * time.Second), Duration(5 * time.Second), false},
+		{"Warmup with ops deadline", 0, 10, Duration(5 * time.Second), 0, false},
+		{"Cooldown with ops deadline", 0, 10, 0, Duration(5 * time.Second), true},
+		{"Negative warmup", Duration(10 * time.Second), 0, Duration(-time.Second), 0, true},
+		{"Negative cooldown", Duration(10 * time.Second), 0, 0, Duration(-time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			testcase.Runtime = tt.runtime
+			testcase.OpsDeadline = tt.ops
+			testcase.Warmup = tt.warmup
+			testcase.Cooldown = tt.cooldown
+			if err := checkTestCase(testcase); (err != nil) != tt.wantErr {
+				t.Errorf("checkTestCase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkTestCaseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(testcase *TestCaseConfiguration)
+		wantErr bool
+	}{
+		{"Default mode", func(testcase *TestCaseConfiguration) {}, false},
+		{"Run mode", func(testcase *TestCaseConfiguration) { testcase.Mode = ModeRun }, false},
+		{"Unknown mode", func(testcase *TestCaseConfiguration) { testcase.Mode = "fill" }, true},
+		{"Prepare without runtime and weights", func(testcase *TestCaseConfiguration) {
+			testcase.Mode = ModePrepare
+			testcase.Runtime = 0
+			testcase.OpsDeadline = 0
+			testcase.ReadWeight = 0
+		}, false},
+		{"Prepare with clean_after", func(testcase *TestCaseConfiguration) {
+			testcase.Mode = ModePrepare
+			testcase.CleanAfter = true
+		}, true},
+		{"Prepare with assertions", func(testcase *TestCaseConfiguration) {
+			testcase.Mode = ModePrepare
+			testcase.Assert.MinOpsPerSecond = 100
+		}, true},
+		{"Prepare with invalid objects", func(testcase *TestCaseConfiguration) {
+			testcase.Mode = ModePrepare
+			testcase.Objects.SizeDistribution = "gaussian"
+		}, true},
+		{"Cleanup with bucket_prefix", func(testcase *TestCaseConfiguration) {
+			testcase.Mode = ModeCleanup
+			testcase.BucketPrefix = "gosbench-"
+		}, false},
+		{"Cleanup without bucket_prefix", func(testcase *TestCaseConfiguration) { testcase.Mode = ModeCleanup }, true},
+		{"Cleanup of a dataset", func(testcase *TestCaseConfiguration) {
+			testcase.Mode = ModeCleanup
+			testcase.DatasetConfig = &Dataset{Name: "small", BucketPrefix: "dataset-"}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			tt.modify(testcase)
+			if err := checkTestCase(testcase); (err != nil) != tt.wantErr {
+				t.Errorf("checkTestCase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkTestCaseVersioning(t *testing.T) {
+	tests := []struct {
+		name         string
+		versioning   string
+		mode         string
+		weight       int
+		versions     int
+		wantVersions int
+		wantErr      bool
+	}{
+		{"No versioning", "", "", 0, 0, 1, false},
+		{"Versioning without version operations", VersioningEnabled, "", 0, 0, 1, false},
+		{"Version operations", VersioningEnabled, "", 1, 3, 3, false},
+		{"Version operations without versioning", "", "", 1, 0, 0, true},
+		{"Unknown versioning", "suspended", "", 0, 0, 0, true},
+		{"Negative versions", VersioningEnabled, "", 1, -1, 0, true},
+		{"Mode run without version operations", VersioningEnabled, ModeRun, 0, 0, 1, false},
+		{"Version reads in mode run", VersioningEnabled, ModeRun, 1, 3, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			testcase.Versioning = tt.versioning
+			testcase.Mode = tt.mode
+			testcase.VersionReadWeight = tt.weight
+			testcase.VersionsPerObject = tt.versions
+			err := checkTestCase(testcase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkTestCase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && testcase.VersionsPerObject != tt.wantVersions {
+				t.Errorf("checkTestCase() versions = %d, want %d", testcase.VersionsPerObject, tt.wantVersions)
+			}
+		})
+	}
+}
+
+func Test_checkTestCaseOverwrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		sizeChange float64
+		dataset    bool
+		wantErr    bool
+	}{
+		{"Overwrite with the same size", 0, false, false},
+		{"Overwrite with size change", 0.5, false, false},
+		{"Negative size change", -0.5, false, true},
+		{"Size change above 1", 1.5, false, true},
+		{"Overwrite on a dataset", 0, true, false},
+		{"Size change on a dataset", 0.5, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			testcase.ReadWeight = 0
+			testcase.OverwriteWeight = 1
+			testcase.OverwriteSizeChange = tt.sizeChange
+			if tt.dataset {
+				testcase.DatasetConfig = &Dataset{Name: "small"}
+			}
+			if err := checkTestCase(testcase); (err != nil) != tt.wantErr {
+				t.Errorf("checkTestCase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkTestCaseMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     int
+		count    int
+		size     int
+		wantTags int
+		wantErr  bool
+	}{
+		{"Defaults", 0, 0, 0, 1, false},
+		{"Tags and metadata", 10, 8, 64, 10, false},
+		{"Too many tags", 11, 0, 0, 0, true},
+		{"Negative tags", -1, 0, 0, 0, true},
+		{"Negative metadata count", 0, -1, 0, 0, true},
+		{"Negative metadata size", 0, 1, -1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			testcase.PutTaggingWeight = 1
+			testcase.TagsPerObject = tt.tags
+			testcase.Metadata.Count = tt.count
+			testcase.Metadata.Size = tt.size
+			err := checkTestCase(testcase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkTestCase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && testcase.TagsPerObject != tt.wantTags {
+				t.Errorf("checkTestCase() tags = %d, want %d", testcase.TagsPerObject, tt.wantTags)
+			}
+		})
+	}
+}
+
+func Test_checkTestCaseList(t *testing.T) {
+	tests := []struct {
+		name            string
+		mode            string
+		version         int
+		maxKeys         int32
+		depth           int
+		prefixDepth     int
+		wantVersion     int
+		wantPrefixDepth int
+		wantErr         bool
+	}{
+		{"Defaults", "", 0, 0, 0, 0, 2, 0, false},
+		{"Full listing with ListObjects", ListModeFull, 1, 100, 0, 0, 1, 0, false},
+		{"Directory defaults", ListModeDirectory, 0, 0, 0, 0, 2, 1, false},
+		{"Directory with prefix depth", ListModeDirectory, 2, 0, 4, 3, 2, 3, false},
+		{"Unknown mode", "tree", 0, 0, 0, 0, 0, 0, true},
+		{"Unknown version", ListModeFull, 3, 0, 0, 0, 0, 0, true},
+		{"Too many keys", ListModeFull, 0, 1001, 0, 0, 0, 0, true},
+		{"Prefix deeper than the tree", ListModeDirectory, 0, 0, 2, 3, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			testcase.ListWeight = 1
+			testcase.List.Mode = tt.mode
+			testcase.List.Version = tt.version
+			testcase.List.MaxKeys = tt.maxKeys
+			testcase.List.Depth = tt.depth
+			testcase.List.PrefixDepth = tt.prefixDepth
+			err := checkTestCase(testcase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkTestCase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if testcase.List.Version != tt.wantVersion || testcase.List.PrefixDepth != tt.wantPrefixDepth {
+				t.Errorf("checkTestCase() version = %d, prefix_depth = %d, want %d, %d", testcase.List.Version, testcase.List.PrefixDepth, tt.wantVersion, tt.wantPrefixDepth)
+			}
+		})
+	}
+}
+
+func Test_checkAssertions(t *testing.T) {
+	rate := func(rate float64) *float64 { return &rate }
+	tests := []struct {
+		name    string
+		assert  Assertions
+		wantErr bool
+	}{
+		{"No assertions", Assertions{}, false},
+		{"All assertions", Assertions{MinOpsPerSecond: 100, MinMiBPerSecond: 10, MaxP99Latency: map[string]float64{"get": 50}, MaxErrorRate: rate(0)}, false},
+		{"Negative ops", Assertions{MinOpsPerSecond: -1}, true},
+		{"Error rate above 1", Assertions{MaxErrorRate: rate(2)}, true},
+		{"Zero latency", Assertions{MaxP99Latency: map[string]float64{"GET": 0}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkAssertions(&tt.assert); (err != nil) != tt.wantErr {
+				t.Errorf("checkAssertions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	assert := Assertions{MaxP99Latency: map[string]float64{"get": 50}}
+	if err := checkAssertions(&assert); err != nil || assert.MaxP99Latency["GET"] != 50 {
+		t.Errorf("checkAssertions() did not normalize the method names: %v", assert.MaxP99Latency)
+	}
+}
+
+func Test_checkS3Config(t *testing.T) {
+	tests := []struct {
+		name     string
+		s3Config *S3Configuration
+		wantErr  bool
+	}{
+		{"No endpoint defined", &S3Configuration{}, true},
+		{"Single endpoint", &S3Configuration{Endpoint: "http://rgw1:80"}, false},
+		{"Endpoint list", &S3Configuration{Endpoints: []string{"http://rgw1:80", "http://rgw2:80"}, LoadBalancing: "least-outstanding"}, false},
+		{"Wrong load balancing", &S3Configuration{Endpoint: "http://rgw1:80", LoadBalancing: "fastest"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkS3Config(tt.s3Config); (err != nil) != tt.wantErr {
+				t.Errorf("checkS3Config() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3Configuration_EndpointList(t *testing.T) {
+	tests := []struct {
+		name     string
+		s3Config *S3Configuration
+		want     []string
+	}{
+		{"Nothing set", &S3Configuration{}, nil},
+		{"Only endpoint", &S3Configuration{Endpoint: "http://rgw1:80"}, []string{"http://rgw1:80"}},
+		{"Only endpoints", &S3Configuration{Endpoints: []string{"http://rgw1:80", "http://rgw2:80"}}, []string{"http://rgw1:80", "http://rgw2:80"}},
+		{"Both with duplicate", &S3Configuration{Endpoint: "http://rgw1:80", Endpoints: []string{"http://rgw1:80", "http://rgw2:80"}}, []string{"http://rgw1:80", "http://rgw2:80"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.s3Config.EndpointList(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EndpointList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_checkDistribution(t *testing.T) {
 	type args struct {
 		distribution string
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Dataset is a named, deterministic population of objects. All tests that
+// use the same dataset work on the same buckets and objects, so objects
+// that exist already with the right size are not uploaded again
+type Dataset struct {
+	Name         string `yaml:"name" json:"name"`
+	BucketPrefix string `yaml:"bucket_prefix" json:"bucket_prefix"`
+	ObjectPrefix string `yaml:"object_prefix" json:"object_prefix"`
+	Buckets      uint64 `yaml:"buckets" json:"buckets"`
+	// Objects is the number of objects per bucket
+	Objects          uint64 `yaml:"objects" json:"objects"`
+	SizeMin          uint64 `yaml:"size_min" json:"size_min"`
+	SizeMax          uint64 `yaml:"size_max" json:"size_max"`
+	SizeDistribution string `yaml:"size_distribution" json:"size_distribution"`
+	Unit             string `yaml:"unit" json:"unit"`
+	// Seed determines the object sizes - the same seed always results in the same dataset
+	Seed int64 `yaml:"seed" json:"seed"`
+}
+
+// DatasetObject is a single object of a dataset
+type DatasetObject struct {
+	Bucket string
+	Key    string
+	Size   uint64
+}
+
+// BucketName returns the name of the bucket with the given index
+func (d *Dataset) BucketName(bucket uint64) string {
+	return fmt.Sprintf("%s%d", d.BucketPrefix, bucket)
+}
+
+// Partition returns the objects of the dataset that belong to the worker
+// with the given index. Objects are dealt to the workers in turns, so every
+// object belongs to exactly one worker - no matter how many workers a test has
+func (d *Dataset) Partition(worker int, workers int) []DatasetObject {
+	if workers < 1 {
+		workers = 1
+	}
+	var partition []DatasetObject
+	// The sizes of all objects are drawn, so that they do not depend on the partition
+	rng := rand.New(rand.NewSource(d.Seed))
+	for bucket := uint64(0); bucket < d.Buckets; bucket++ {
+		for object := uint64(0); object < d.Objects; object++ {
+			size := d.objectSize(rng, object)
+			if (bucket*d.Objects+object)%uint64(workers) != uint64(worker) {
+				continue
+			}
+			partition = append(partition, DatasetObject{
+				Bucket: d.BucketName(bucket),
+				Key:    fmt.Sprintf("%s%d", d.ObjectPrefix, object),
+				Size:   size,
+			})
+		}
+	}
+	return partition
+}
+
+func (d *Dataset) objectSize(rng *rand.Rand, object uint64) uint64 {
+	switch d.SizeDistribution {
+	case "random":
+		return d.SizeMin + rng.Uint64()%(d.SizeMax-d.SizeMin+1)
+	case "sequential":
+		return d.SizeMin + object%(d.SizeMax-d.SizeMin+1)
+	}
+	return d.SizeMin
+}
+
+func checkDataset(dataset *Dataset) error {
+	if dataset.Name == "" {
+		return fmt.Errorf("Please set the name of every dataset")
+	}
+	if dataset.BucketPrefix == "" {
+		return fmt.Errorf("Please set the bucket_prefix of dataset %s", dataset.Name)
+	}
+	if dataset.Buckets == 0 || dataset.Objects == 0 {
+		return fmt.Errorf("Please set the number of buckets and objects of dataset %s", dataset.Name)
+	}
+	if dataset.SizeMin == 0 || dataset.SizeMax < dataset.SizeMin {
+		return fmt.Errorf("Please set size_min and a size_max of at least size_min for dataset %s", dataset.Name)
+	}
+	if err := checkDistribution(dataset.SizeDistribution, fmt.Sprintf("Dataset %s size_distribution", dataset.Name)); err != nil {
+		return err
+	}
+	multiplicator, err := unitMultiplicator(dataset.Unit)
+	if err != nil {
+		return err
+	}
+	dataset.SizeMin = dataset.SizeMin * multiplicator
+	dataset.SizeMax = dataset.SizeMax * multiplicator
+	return nil
+}
+
+// checkDatasets checks all datasets and links them to the tests that use them
+func checkDatasets(config *Testconf) error {
+	datasets := map[string]*Dataset{}
+	for _, dataset := range config.Datasets {
+		if err := checkDataset(dataset); err != nil {
+			return err
+		}
+		if _, ok := datasets[dataset.Name]; ok {
+			return fmt.Errorf("Dataset %s is defined more than once", dataset.Name)
+		}
+		datasets[dataset.Name] = dataset
+	}
+	for _, testcase := range config.Tests {
+		if testcase.Dataset == "" {
+			continue
+		}
+		dataset, ok := datasets[testcase.Dataset]
+		if !ok {
+			return fmt.Errorf("Test %s uses the unknown dataset %s", testcase.Name, testcase.Dataset)
+		}
+		testcase.DatasetConfig = dataset
+	}
+	return nil
+}
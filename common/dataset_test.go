@@ -0,0 +1,114 @@
+package common
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func testDataset() *Dataset {
+	return &Dataset{
+		Name:             "ds",
+		BucketPrefix:     "bucket-",
+		ObjectPrefix:     "obj",
+		Buckets:          2,
+		Objects:          5,
+		SizeMin:          10,
+		SizeMax:          20,
+		SizeDistribution: "random",
+		Seed:             42,
+	}
+}
+
+func TestDataset_Partition(t *testing.T) {
+	dataset := testDataset()
+	all := dataset.Partition(0, 1)
+	if len(all) != 10 {
+		t.Fatalf("Partition(0, 1) returned %d objects, want 10", len(all))
+	}
+	for _, object := range all {
+		if object.Size < dataset.SizeMin || object.Size > dataset.SizeMax {
+			t.Errorf("Partition(0, 1) object %s has size %d outside of 10..20", object.Key, object.Size)
+		}
+	}
+	again := dataset.Partition(0, 1)
+	if !reflect.DeepEqual(all, again) {
+		t.Errorf("Partition() is not deterministic:\n%v\n%v", all, again)
+	}
+
+	// The partitions of several workers form the same dataset
+	var merged []DatasetObject
+	for worker := 0; worker < 3; worker++ {
+		merged = append(merged, dataset.Partition(worker, 3)...)
+	}
+	sortObjects := func(objects []DatasetObject) {
+		sort.Slice(objects, func(i, j int) bool {
+			return objects[i].Bucket+"/"+objects[i].Key < objects[j].Bucket+"/"+objects[j].Key
+		})
+	}
+	sortObjects(all)
+	sortObjects(merged)
+	if !reflect.DeepEqual(all, merged) {
+		t.Errorf("Partitions of 3 workers = %v, want %v", merged, all)
+	}
+
+	dataset.Seed = 7
+	if reflect.DeepEqual(dataset.Partition(0, 1), again) {
+		t.Errorf("Partition() with another seed returned the same sizes")
+	}
+}
+
+func Test_checkDatasets(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(config *Testconf)
+		wantErr bool
+	}{
+		{"Valid dataset", func(config *Testconf) {}, false},
+		{"Unknown dataset", func(config *Testconf) { config.Tests[0].Dataset = "other" }, true},
+		{"Duplicate dataset", func(config *Testconf) { config.Datasets = append(config.Datasets, testDataset()) }, true},
+		{"Missing bucket prefix", func(config *Testconf) { config.Datasets[0].BucketPrefix = "" }, true},
+		{"Size max below size min", func(config *Testconf) { config.Datasets[0].SizeMax = 5 }, true},
+		{"Invalid unit", func(config *Testconf) { config.Datasets[0].Unit = "XB" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataset := testDataset()
+			dataset.Unit = "KB"
+			config := &Testconf{
+				Datasets: []*Dataset{dataset},
+				Tests:    []*TestCaseConfiguration{{Name: "test", Dataset: "ds"}},
+			}
+			tt.modify(config)
+			err := checkDatasets(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkDatasets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if config.Tests[0].DatasetConfig != dataset {
+				t.Errorf("checkDatasets() did not link the dataset to the test")
+			}
+			if dataset.SizeMin != 10*KILOBYTE || dataset.SizeMax != 20*KILOBYTE {
+				t.Errorf("checkDatasets() sizes = %d..%d, want them in bytes", dataset.SizeMin, dataset.SizeMax)
+			}
+		})
+	}
+}
+
+func Test_checkTestCaseDataset(t *testing.T) {
+	testcase := &TestCaseConfiguration{Runtime: Duration(10), ReadWeight: 1, DatasetConfig: testDataset()}
+	if err := checkTestCase(testcase); err != nil {
+		t.Errorf("checkTestCase() of a test with a dataset and without objects error = %v", err)
+	}
+	testcase.CleanAfter = true
+	if err := checkTestCase(testcase); err == nil {
+		t.Errorf("checkTestCase() expected an error for clean_after with a dataset")
+	}
+	testcase.CleanAfter = false
+	testcase.DeleteWeight = 1
+	if err := checkTestCase(testcase); err == nil {
+		t.Errorf("checkTestCase() expected an error for delete_weight with a dataset")
+	}
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// Modes of the server-side encryption
+const (
+	// EncryptionSSES3 encrypts with keys managed by the S3 server
+	EncryptionSSES3 = "sse-s3"
+	// EncryptionSSEKMS encrypts with a key of the key management service
+	EncryptionSSEKMS = "sse-kms"
+	// EncryptionSSEC encrypts with a key sent by the client on every request
+	EncryptionSSEC = "sse-c"
+)
+
+// customerKeySize is the size of an SSE-C key - S3 only supports AES256
+const customerKeySize = 32
+
+// Encryption configures the server-side encryption of all objects a test
+// writes and reads
+type Encryption struct {
+	// Mode is one of the Encryption constants - empty disables the encryption
+	Mode string `yaml:"mode" json:"mode"`
+	// KMSKeyID is the key of SSE-KMS - the default key of the server when empty
+	KMSKeyID string `yaml:"kms_key_id" json:"kms_key_id"`
+	// CustomerKey is the base64 encoded key of SSE-C. When it is not set,
+	// the server generates one key per run that all tests share
+	CustomerKey string `yaml:"customer_key" json:"customer_key"`
+}
+
+func checkEncryption(testcase *TestCaseConfiguration) error {
+	encryption := &testcase.Encryption
+	switch encryption.Mode {
+	case "", EncryptionSSES3, EncryptionSSEKMS, EncryptionSSEC:
+	default:
+		return fmt.Errorf("Unknown encryption mode %s - use %s, %s or %s", encryption.Mode, EncryptionSSES3, EncryptionSSEKMS, EncryptionSSEC)
+	}
+	if encryption.KMSKeyID != "" && encryption.Mode != EncryptionSSEKMS {
+		return fmt.Errorf("The kms_key_id can only be used with encryption mode %s", EncryptionSSEKMS)
+	}
+	if encryption.Mode != EncryptionSSEC {
+		if encryption.CustomerKey != "" {
+			return fmt.Errorf("The customer_key can only be used with encryption mode %s", EncryptionSSEC)
+		}
+		return nil
+	}
+	if encryption.CustomerKey == "" {
+		// The key is generated for all tests at once by checkCustomerKeys
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encryption.CustomerKey)
+	if err != nil || len(key) != customerKeySize {
+		return fmt.Errorf("The customer_key needs to be a base64 encoded key of %d bytes", customerKeySize)
+	}
+	return nil
+}
+
+// checkCustomerKeys generates one SSE-C key for all tests that do not set
+// their customer_key. Tests that work on the objects of earlier tests - of
+// a dataset or with mode run - can only read them with the same key
+func checkCustomerKeys(config *Testconf) error {
+	var generated string
+	for _, testcase := range config.Tests {
+		encryption := &testcase.Encryption
+		if encryption.Mode != EncryptionSSEC || encryption.CustomerKey != "" {
+			continue
+		}
+		if generated == "" {
+			key := make([]byte, customerKeySize)
+			if _, err := rand.Read(key); err != nil {
+				return fmt.Errorf("Could not generate the customer key: %w", err)
+			}
+			generated = base64.StdEncoding.EncodeToString(key)
+		}
+		encryption.CustomerKey = generated
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func Test_checkEncryption(t *testing.T) {
+	validKey := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	tests := []struct {
+		name       string
+		encryption Encryption
+		wantErr    bool
+	}{
+		{"no encryption", Encryption{}, false},
+		{"SSE-S3", Encryption{Mode: EncryptionSSES3}, false},
+		{"SSE-KMS with default key", Encryption{Mode: EncryptionSSEKMS}, false},
+		{"SSE-KMS with key ID", Encryption{Mode: EncryptionSSEKMS, KMSKeyID: "arn:aws:kms:eu-1:123:key/abc"}, false},
+		{"SSE-C with generated key", Encryption{Mode: EncryptionSSEC}, false},
+		{"SSE-C with given key", Encryption{Mode: EncryptionSSEC, CustomerKey: validKey}, false},
+		{"unknown mode", Encryption{Mode: "aes"}, true},
+		{"KMS key ID without SSE-KMS", Encryption{Mode: EncryptionSSES3, KMSKeyID: "abc"}, true},
+		{"customer key without SSE-C", Encryption{CustomerKey: validKey}, true},
+		{"customer key not base64", Encryption{Mode: EncryptionSSEC, CustomerKey: "not a key"}, true},
+		{"customer key too short", Encryption{Mode: EncryptionSSEC, CustomerKey: base64.StdEncoding.EncodeToString(make([]byte, 16))}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			testcase.Encryption = tt.encryption
+			err := checkEncryption(testcase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkEncryption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if testcase.Encryption.CustomerKey != tt.encryption.CustomerKey {
+				t.Errorf("checkEncryption() changed the customer key to %q", testcase.Encryption.CustomerKey)
+			}
+		})
+	}
+}
+
+func Test_checkCustomerKeys(t *testing.T) {
+	givenKey := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	prepare, run, given, plain := validTestCase(), validTestCase(), validTestCase(), validTestCase()
+	prepare.Encryption.Mode, run.Encryption.Mode = EncryptionSSEC, EncryptionSSEC
+	given.Encryption = Encryption{Mode: EncryptionSSEC, CustomerKey: givenKey}
+	config := &Testconf{Tests: []*TestCaseConfiguration{prepare, run, given, plain}}
+	if err := checkCustomerKeys(config); err != nil {
+		t.Fatalf("checkCustomerKeys() error = %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(prepare.Encryption.CustomerKey)
+	if err != nil || len(key) != 32 {
+		t.Errorf("checkCustomerKeys() customer key %q is not a base64 encoded key of 32 bytes", prepare.Encryption.CustomerKey)
+	}
+	if run.Encryption.CustomerKey != prepare.Encryption.CustomerKey {
+		t.Errorf("checkCustomerKeys() generated different keys %q and %q for the tests of one config", prepare.Encryption.CustomerKey, run.Encryption.CustomerKey)
+	}
+	if given.Encryption.CustomerKey != givenKey {
+		t.Errorf("checkCustomerKeys() replaced the given customer key")
+	}
+	if plain.Encryption.CustomerKey != "" {
+		t.Errorf("checkCustomerKeys() set a customer key on a test without SSE-C")
+	}
+
+	// Every config gets its own key
+	other := validTestCase()
+	other.Encryption.Mode = EncryptionSSEC
+	if err := checkCustomerKeys(&Testconf{Tests: []*TestCaseConfiguration{other}}); err != nil {
+		t.Fatalf("checkCustomerKeys() error = %v", err)
+	}
+	if other.Encryption.CustomerKey == prepare.Encryption.CustomerKey {
+		t.Errorf("checkCustomerKeys() generated the same customer key for two configs")
+	}
+}
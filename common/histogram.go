@@ -0,0 +1,107 @@
+package common
+
+import (
+	"math"
+	"sort"
+)
+
+// The bucket boundaries of the latency histogram grow exponentially by
+// histogramGrowth, starting at histogramMinimum milliseconds. This keeps
+// the relative error of percentiles below 5% while staying mergeable
+// across workers and intervals
+const (
+	histogramMinimum = 0.01
+	histogramGrowth  = 1.05
+)
+
+// Histogram is a mergeable latency histogram in milliseconds
+type Histogram struct {
+	// Buckets maps the bucket index to the number of observations in it
+	Buckets map[int]uint64 `json:"buckets,omitempty"`
+	Count   uint64         `json:"count"`
+	Sum     float64        `json:"sum"`
+	Min     float64        `json:"min"`
+	Max     float64        `json:"max"`
+}
+
+func histogramBucket(value float64) int {
+	if value <= histogramMinimum {
+		return 0
+	}
+	return int(math.Ceil(math.Log(value/histogramMinimum) / math.Log(histogramGrowth)))
+}
+
+func histogramUpperBound(bucket int) float64 {
+	return histogramMinimum * math.Pow(histogramGrowth, float64(bucket))
+}
+
+// Observe adds a single latency in milliseconds
+func (h *Histogram) Observe(value float64) {
+	if h.Buckets == nil {
+		h.Buckets = map[int]uint64{}
+	}
+	if h.Count == 0 || value < h.Min {
+		h.Min = value
+	}
+	if h.Count == 0 || value > h.Max {
+		h.Max = value
+	}
+	h.Buckets[histogramBucket(value)]++
+	h.Count++
+	h.Sum += value
+}
+
+// Merge adds all observations of other to this histogram
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.Count == 0 {
+		return
+	}
+	if h.Buckets == nil {
+		h.Buckets = map[int]uint64{}
+	}
+	if h.Count == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if h.Count == 0 || other.Max > h.Max {
+		h.Max = other.Max
+	}
+	for bucket, count := range other.Buckets {
+		h.Buckets[bucket] += count
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+}
+
+// Mean returns the average latency
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// Quantile returns the latency below which the given fraction (0-1)
+// of all observations fall
+func (h *Histogram) Quantile(quantile float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	buckets := make([]int, 0, len(h.Buckets))
+	for bucket := range h.Buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+
+	rank := uint64(math.Ceil(quantile * float64(h.Count)))
+	if rank == 0 {
+		rank = 1
+	}
+	seen := uint64(0)
+	for _, bucket := range buckets {
+		seen += h.Buckets[bucket]
+		if seen >= rank {
+			return math.Max(h.Min, math.Min(h.Max, histogramUpperBound(bucket)))
+		}
+	}
+	return h.Max
+}
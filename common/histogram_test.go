@@ -0,0 +1,70 @@
+package common
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := &Histogram{}
+	for i := 1; i <= 1000; i++ {
+		h.Observe(float64(i))
+	}
+	tests := []struct {
+		name     string
+		quantile float64
+		want     float64
+	}{
+		{"minimum", 0, 1},
+		{"median", 0.5, 500},
+		{"p90", 0.9, 900},
+		{"p99", 0.99, 990},
+		{"maximum", 1, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.Quantile(tt.quantile)
+			if math.Abs(got-tt.want)/tt.want > histogramGrowth-1 {
+				t.Errorf("Quantile(%v) = %v, want %v within %.0f%%", tt.quantile, got, tt.want, (histogramGrowth-1)*100)
+			}
+		})
+	}
+	if h.Mean() != 500.5 {
+		t.Errorf("Mean() = %v, want 500.5", h.Mean())
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	fast := &Histogram{}
+	slow := &Histogram{}
+	for i := 0; i < 90; i++ {
+		fast.Observe(1)
+	}
+	for i := 0; i < 10; i++ {
+		slow.Observe(100)
+	}
+	merged := &Histogram{}
+	merged.Merge(fast)
+	merged.Merge(slow)
+	merged.Merge(&Histogram{})
+
+	if merged.Count != 100 || merged.Min != 1 || merged.Max != 100 {
+		t.Errorf("Merge() = count %d min %v max %v, want count 100 min 1 max 100", merged.Count, merged.Min, merged.Max)
+	}
+	if got := merged.Mean(); got != 10.9 {
+		t.Errorf("Mean() = %v, want 10.9", got)
+	}
+	if got := merged.Quantile(0.9); math.Abs(got-1) > histogramGrowth-1 {
+		t.Errorf("Quantile(0.9) = %v, want 1", got)
+	}
+	if got := merged.Quantile(0.95); got != 100 {
+		t.Errorf("Quantile(0.95) = %v, want 100", got)
+	}
+}
+
+func TestHistogram_Empty(t *testing.T) {
+	h := &Histogram{}
+	if h.Mean() != 0 || h.Quantile(0.99) != 0 {
+		t.Errorf("Empty histogram should return 0, got mean %v p99 %v", h.Mean(), h.Quantile(0.99))
+	}
+}
@@ -0,0 +1,252 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyTemplate generates the object names of a test from a template with
+// placeholders in curly braces:
+//
+//	{worker}   ID of the worker
+//	{prefix}   object_prefix of the test
+//	{bucket}   index of the bucket
+//	{index}    index of the object in its bucket
+//	{random:N} N random hex digits (16 by default)
+//	{hash:N}   the first N hex digits (4 by default) of a hash of worker, bucket and index
+//	{yyyy}, {mm}, {dd} the parts of Date
+//	{dirs}     Depth levels of directories with Fanout subdirectories each
+//
+// All placeholders only depend on the object, so an object has the same
+// name in every run of the test
+type KeyTemplate struct {
+	Template string `yaml:"template" json:"template"`
+	// Depth and Fanout describe the directory tree of {dirs}
+	Depth  int `yaml:"depth" json:"depth"`
+	Fanout int `yaml:"fanout" json:"fanout"`
+	// Date is the day of the date placeholders as YYYY-MM-DD - the day the
+	// config was checked by default
+	Date string `yaml:"date" json:"date"`
+
+	parts []keyPart
+	date  time.Time
+}
+
+// keyPart is a literal text or a placeholder of a KeyTemplate
+type keyPart struct {
+	literal     string
+	placeholder string
+	length      int
+}
+
+// Default lengths of the placeholders with a length
+var keyPlaceholderLengths = map[string]int{
+	"random": 16,
+	"hash":   4,
+}
+
+// Parse parses and checks the template. It needs to be called before Key
+func (t *KeyTemplate) Parse() error {
+	var parts []keyPart
+	rest := t.Template
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			parts = append(parts, keyPart{literal: rest})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, keyPart{literal: rest[:start]})
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return fmt.Errorf("The key template %s has an unclosed placeholder", t.Template)
+		}
+		part, err := parseKeyPlaceholder(rest[start+1 : start+end])
+		if err != nil {
+			return fmt.Errorf("The key template %s is invalid: %w", t.Template, err)
+		}
+		parts = append(parts, part)
+		rest = rest[start+end+1:]
+	}
+	date, err := time.Parse(time.DateOnly, t.Date)
+	if err != nil {
+		return fmt.Errorf("The date of the key template needs the format YYYY-MM-DD: %w", err)
+	}
+	if t.Depth < 0 || t.Fanout < 0 {
+		return fmt.Errorf("The depth and fanout of the key template must not be negative")
+	}
+	t.parts, t.date = parts, date
+	return nil
+}
+
+func parseKeyPlaceholder(placeholder string) (keyPart, error) {
+	name, length, hasLength := strings.Cut(placeholder, ":")
+	switch name {
+	case "worker", "prefix", "bucket", "index", "yyyy", "mm", "dd", "dirs":
+		if hasLength {
+			return keyPart{}, fmt.Errorf("{%s} does not take a length", name)
+		}
+		return keyPart{placeholder: name}, nil
+	case "random", "hash":
+		if !hasLength {
+			return keyPart{placeholder: name, length: keyPlaceholderLengths[name]}, nil
+		}
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 1 || n > 2*sha256.Size {
+			return keyPart{}, fmt.Errorf("the length of {%s} needs to be between 1 and %d", name, 2*sha256.Size)
+		}
+		return keyPart{placeholder: name, length: n}, nil
+	}
+	return keyPart{}, fmt.Errorf("unknown placeholder {%s}", placeholder)
+}
+
+// Uses returns whether the template contains the given placeholder
+func (t *KeyTemplate) Uses(placeholder string) bool {
+	for _, part := range t.parts {
+		if part.placeholder == placeholder {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the name of the object with the given index in the bucket
+// with the given index of the worker
+func (t *KeyTemplate) Key(worker string, prefix string, bucket uint64, object uint64) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s/%d/%d", worker, bucket, object)))
+	var key strings.Builder
+	for _, part := range t.parts {
+		switch part.placeholder {
+		case "":
+			key.WriteString(part.literal)
+		case "worker":
+			key.WriteString(worker)
+		case "prefix":
+			key.WriteString(prefix)
+		case "bucket":
+			key.WriteString(strconv.FormatUint(bucket, 10))
+		case "index":
+			key.WriteString(strconv.FormatUint(object, 10))
+		case "random":
+			rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(hash[:8]))))
+			random := make([]byte, (part.length+1)/2)
+			rng.Read(random)
+			key.WriteString(hex.EncodeToString(random)[:part.length])
+		case "hash":
+			key.WriteString(hex.EncodeToString(hash[:])[:part.length])
+		case "yyyy":
+			key.WriteString(t.date.Format("2006"))
+		case "mm":
+			key.WriteString(t.date.Format("01"))
+		case "dd":
+			key.WriteString(t.date.Format("02"))
+		case "dirs":
+			key.WriteString(t.dirs(object))
+		}
+	}
+	return key.String()
+}
+
+// Pattern returns a regular expression that matches all names the
+// template generates with the given object prefix - for any worker, bucket,
+// object and date
+func (t *KeyTemplate) Pattern(prefix string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, part := range t.parts {
+		switch part.placeholder {
+		case "":
+			pattern.WriteString(regexp.QuoteMeta(part.literal))
+		case "worker":
+			pattern.WriteString(`w\d+`)
+		case "prefix":
+			pattern.WriteString(regexp.QuoteMeta(prefix))
+		case "bucket", "index":
+			pattern.WriteString(`\d+`)
+		case "random", "hash":
+			fmt.Fprintf(&pattern, "[0-9a-f]{%d}", part.length)
+		case "yyyy":
+			pattern.WriteString(`\d{4}`)
+		case "mm", "dd":
+			pattern.WriteString(`\d{2}`)
+		case "dirs":
+			dirs := make([]string, t.Depth)
+			for i := range dirs {
+				dirs[i] = `d\d+`
+			}
+			pattern.WriteString(strings.Join(dirs, "/"))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// BucketNameMatcher returns a function that reports whether a name is the
+// name of a bucket that a test with the given bucket_prefix creates - the
+// prefix and the number of the bucket, behind the worker ID unless the
+// workers share their buckets
+func BucketNameMatcher(prefix string) func(name string) bool {
+	return regexp.MustCompile(`^(w\d+)?` + regexp.QuoteMeta(prefix) + `\d+$`).MatchString
+}
+
+// ObjectPrefixMatcher returns a function that reports whether a name starts
+// with the object_prefix of a test - directly or behind the worker ID that
+// is put in front of it
+func ObjectPrefixMatcher(prefix string) func(name string) bool {
+	return regexp.MustCompile(`^(w\d+)?` + regexp.QuoteMeta(prefix)).MatchString
+}
+
+// dirs returns the directories of the object separated by slashes. Every
+// directory holds Fanout subdirectories and the deepest ones Fanout objects
+func (t *KeyTemplate) dirs(object uint64) string {
+	fanout := uint64(max(t.Fanout, 1))
+	dirs := make([]string, 0, t.Depth)
+	for level := 0; level < t.Depth; level++ {
+		divisor := uint64(1)
+		for i := level; i < t.Depth; i++ {
+			divisor *= fanout
+		}
+		dirs = append(dirs, fmt.Sprintf("d%d", object/divisor%fanout))
+	}
+	return strings.Join(dirs, "/")
+}
+
+func checkKeyTemplate(testcase *TestCaseConfiguration) error {
+	template := &testcase.KeyTemplate
+	if template.Template == "" {
+		return nil
+	}
+	if testcase.DatasetConfig != nil {
+		return fmt.Errorf("When using a dataset, key_template can not be set - the dataset names its objects")
+	}
+	if testcase.List.Mode == ListModeDirectory {
+		return fmt.Errorf("The list mode %s can not be combined with a key_template - use {dirs} in the template instead", ListModeDirectory)
+	}
+	if template.Date == "" {
+		template.Date = time.Now().UTC().Format(time.DateOnly)
+	}
+	if template.Depth == 0 {
+		template.Depth = 2
+	}
+	if template.Fanout == 0 {
+		template.Fanout = 10
+	}
+	if err := template.Parse(); err != nil {
+		return err
+	}
+	if !template.Uses("index") && !template.Uses("random") && !template.Uses("hash") {
+		return fmt.Errorf("The key template %s needs {index}, {random} or {hash} to give every object its own name", template.Template)
+	}
+	if testcase.WorkerShareBuckets && !template.Uses("worker") && !template.Uses("random") && !template.Uses("hash") {
+		return fmt.Errorf("When using worker_share_buckets, the key template %s needs {worker}, {random} or {hash} to give the objects of every worker their own names", template.Template)
+	}
+	return nil
+}
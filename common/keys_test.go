@@ -0,0 +1,201 @@
+package common
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestKeyTemplate_Key(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		depth    int
+		fanout   int
+		want     string
+	}{
+		{"flat", "{worker}{prefix}{index}", 0, 0, `^w1obj123$`},
+		{"date parts", "tenant/{yyyy}/{mm}/{dd}/{index}", 0, 0, `^tenant/2024/03/07/123$`},
+		{"directories", "{dirs}/{index}", 2, 10, `^d1/d2/123$`},
+		{"directories with small fanout", "{bucket}/{dirs}/{index}", 3, 4, `^5/d1/d3/d2/123$`},
+		{"hash and random", "{hash:2}/{random}", 0, 0, `^[0-9a-f]{2}/[0-9a-f]{16}$`},
+		{"odd random length", "{random:5}", 0, 0, `^[0-9a-f]{5}$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &KeyTemplate{Template: tt.template, Depth: tt.depth, Fanout: tt.fanout, Date: "2024-03-07"}
+			if err := template.Parse(); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got := template.Key("w1", "obj", 5, 123)
+			if !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("Key() = %v, want %v", got, tt.want)
+			}
+			// The names must not change between runs of a test
+			if again := template.Key("w1", "obj", 5, 123); again != got {
+				t.Errorf("Key() = %v on the second call, want %v", again, got)
+			}
+		})
+	}
+}
+
+func TestKeyTemplate_KeyUnique(t *testing.T) {
+	template := &KeyTemplate{Template: "{hash:8}/{random:32}", Date: "2024-03-07"}
+	if err := template.Parse(); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	keys := map[string]bool{}
+	for _, worker := range []string{"w0", "w1"} {
+		for object := uint64(0); object < 1000; object++ {
+			keys[template.Key(worker, "", 0, object)] = true
+		}
+	}
+	if len(keys) != 2000 {
+		t.Errorf("Key() returned %d different names for 2000 objects", len(keys))
+	}
+}
+
+func TestKeyTemplate_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		date     string
+		wantErr  bool
+	}{
+		{"all placeholders", "{worker}/{prefix}/{bucket}/{yyyy}{mm}{dd}/{dirs}/{hash:64}-{random:1}-{index}", "2024-03-07", false},
+		{"only literals", "object", "2024-03-07", false},
+		{"unknown placeholder", "{tenant}/{index}", "2024-03-07", true},
+		{"unclosed placeholder", "{index", "2024-03-07", true},
+		{"length on placeholder without length", "{index:3}", "2024-03-07", true},
+		{"hash too long", "{hash:65}", "2024-03-07", true},
+		{"random without digits", "{random:0}", "2024-03-07", true},
+		{"invalid date", "{index}", "07.03.2024", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &KeyTemplate{Template: tt.template, Date: tt.date}
+			if err := template.Parse(); (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkKeyTemplate(t *testing.T) {
+	tests := []struct {
+		name       string
+		template   string
+		shared     bool
+		listMode   string
+		dataset    bool
+		wantErr    bool
+		wantDepth  int
+		wantFanout int
+	}{
+		{"no template", "", false, "", false, false, 0, 0},
+		{"defaults", "{worker}/{dirs}/{index}", false, "", false, false, 2, 10},
+		{"names not unique", "{worker}/{yyyy}", false, "", false, true, 0, 0},
+		{"shared buckets without worker", "{index}", true, "", false, true, 0, 0},
+		{"shared buckets with hash", "{hash}/{index}", true, "", false, false, 2, 10},
+		{"list mode directory", "{index}", false, ListModeDirectory, false, true, 0, 0},
+		{"dataset", "{index}", false, "", true, true, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := validTestCase()
+			testcase.KeyTemplate.Template = tt.template
+			testcase.WorkerShareBuckets = tt.shared
+			testcase.List.Mode = tt.listMode
+			if tt.dataset {
+				testcase.DatasetConfig = testDataset()
+			}
+			err := checkKeyTemplate(testcase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkKeyTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if testcase.KeyTemplate.Depth != tt.wantDepth || testcase.KeyTemplate.Fanout != tt.wantFanout {
+				t.Errorf("checkKeyTemplate() depth %d fanout %d, want %d and %d", testcase.KeyTemplate.Depth, testcase.KeyTemplate.Fanout, tt.wantDepth, tt.wantFanout)
+			}
+			if tt.template != "" && testcase.KeyTemplate.Date == "" {
+				t.Errorf("checkKeyTemplate() did not set the date")
+			}
+		})
+	}
+}
+
+func TestKeyTemplate_Pattern(t *testing.T) {
+	template := &KeyTemplate{Template: "tenant/{worker}{prefix}/{yyyy}/{mm}/{dd}/{hash:2}/{dirs}/{random:8}-{index}", Depth: 2, Fanout: 10, Date: "2024-03-07"}
+	if err := template.Parse(); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	pattern := template.Pattern("obj.")
+	for object := uint64(0); object < 100; object++ {
+		if key := template.Key("w12", "obj.", 3, object); !pattern.MatchString(key) {
+			t.Fatalf("Pattern() = %v does not match the generated key %v", pattern, key)
+		}
+	}
+	for _, key := range []string{
+		"tenant/w1obj./2024/03/07/ab/d0/d1/0123abcd-1/extra",
+		"tenant/w1objx/2024/03/07/ab/d0/d1/0123abcd-1",
+		"tenant/w1obj./2024/03/07/ab/d0/0123abcd-1",
+		"other/w1obj./2024/03/07/ab/d0/d1/0123abcd-1",
+		"tenant/prod/2024/03/07/ab/d0/d1/0123abcd-1",
+	} {
+		if pattern.MatchString(key) {
+			t.Errorf("Pattern() = %v matches %v", pattern, key)
+		}
+	}
+}
+
+func TestBucketNameMatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket string
+		prefix string
+		want   bool
+	}{
+		{"shared bucket", "bench0", "bench", true},
+		{"bucket of a worker", "w12bench3", "bench", true},
+		{"prefix with digits", "w01bench10", "1bench", true},
+		{"unrelated bucket with the same start", "benchmark-prod", "bench", false},
+		{"no bucket number", "w1bench", "bench", false},
+		{"suffix after the number", "bench0-old", "bench", false},
+		{"other worker ID format", "worker1bench0", "bench", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BucketNameMatcher(tt.prefix)(tt.bucket); got != tt.want {
+				t.Errorf("BucketNameMatcher(%q)(%q) = %v, want %v", tt.prefix, tt.bucket, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectPrefixMatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		object string
+		prefix string
+		want   bool
+	}{
+		{"shared bucket", "obj12", "obj", true},
+		{"object of a worker", "w3obj12", "obj", true},
+		{"prefix starting with a digit", "w01bench0", "1bench", true},
+		{"prefix of digits only", "w2123", "123", true},
+		{"prefix starting with a digit without worker ID", "1bench0", "1bench", true},
+		{"digits of the prefix missing", "w0bench0", "1bench", false},
+		{"other prefix", "w1other0", "obj", false},
+		{"prefix not at the start", "data/obj1", "obj", false},
+		{"prefix with regexp characters", "w1obj.1", "obj.", true},
+		{"prefix with regexp characters not matching", "w1objx1", "obj.", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ObjectPrefixMatcher(tt.prefix)(tt.object); got != tt.want {
+				t.Errorf("ObjectPrefixMatcher(%q)(%q) = %v, want %v", tt.prefix, tt.object, got, tt.want)
+			}
+		})
+	}
+}
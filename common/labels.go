@@ -0,0 +1,47 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseLabels parses worker labels given in the form
+// "key1=value1,key2=value2" into a map
+func ParseLabels(labels string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, pair := range strings.Split(labels, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("Could not parse label %q - please use the form key=value", pair)
+		}
+		result[key] = strings.TrimSpace(value)
+	}
+	return result, nil
+}
+
+// MatchLabels checks whether all key/value pairs of the selector are
+// present in the given labels. An empty selector matches everything
+func MatchLabels(selector map[string]string, labels map[string]string) bool {
+	for key, value := range selector {
+		if labelValue, ok := labels[key]; !ok || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatLabels returns the labels in a stable "key1=value1,key2=value2" form
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"single label", "zone=eu1", map[string]string{"zone": "eu1"}, false},
+		{"multiple labels with spaces", "zone=eu1, rack = r12 ,tier=", map[string]string{"zone": "eu1", "rack": "r12", "tier": ""}, false},
+		{"missing value separator", "zone", nil, true},
+		{"missing key", "=eu1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabels(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLabels() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchLabels(t *testing.T) {
+	labels := map[string]string{"hostname": "node1", "zone": "eu1", "rack": "r12"}
+	tests := []struct {
+		name     string
+		selector map[string]string
+		want     bool
+	}{
+		{"empty selector", nil, true},
+		{"matching selector", map[string]string{"zone": "eu1"}, true},
+		{"matching multiple keys", map[string]string{"zone": "eu1", "rack": "r12"}, true},
+		{"wrong value", map[string]string{"zone": "eu2"}, false},
+		{"missing key", map[string]string{"site": "a"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchLabels(tt.selector, labels); got != tt.want {
+				t.Errorf("MatchLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	if got := FormatLabels(map[string]string{"zone": "eu1", "hostname": "node1"}); got != "hostname=node1,zone=eu1" {
+		t.Errorf("FormatLabels() = %v, want %v", got, "hostname=node1,zone=eu1")
+	}
+}
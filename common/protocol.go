@@ -0,0 +1,311 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ProtocolVersion is the version of the wire protocol between server and
+// worker. It needs to be increased with every incompatible change - server
+// and worker refuse to talk to each other when their versions differ
+const ProtocolVersion = 1
+
+// HandshakeTimeout is the time a peer gets to complete the handshake
+var HandshakeTimeout = 10 * time.Second
+
+// InstanceID identifies this process. Workers send it in their hello, so
+// the server can tell apart workers that share a host or their labels
+var InstanceID = newInstanceID()
+
+func newInstanceID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Sprintf("Could not generate the instance ID: %v", err))
+	}
+	return hex.EncodeToString(id)
+}
+
+// MessageKind determines the meaning of a WorkerMessage
+type MessageKind string
+
+const (
+	// MessageHello is sent by the worker right after connecting
+	MessageHello MessageKind = "hello"
+	// MessageWelcome is the answer of the server to an accepted hello
+	MessageWelcome MessageKind = "welcome"
+	// MessageInit hands the config of the next test to the worker
+	MessageInit MessageKind = "init"
+	// MessagePrepProgress carries the progress of the preparations
+	MessagePrepProgress MessageKind = "preparation progress"
+	// MessagePreparationsDone tells the server that the worker is ready to start
+	MessagePreparationsDone MessageKind = "preparations done"
+	// MessagePing asks the server for its clock to estimate the clock offset
+	MessagePing MessageKind = "ping"
+	// MessagePong answers a ping with the server clock
+	MessagePong MessageKind = "pong"
+	// MessageStartWork starts the performance test on the worker
+	MessageStartWork MessageKind = "start work"
+	// MessageProgress carries the stats of the intervals that were
+	// completed since the last progress message of a running test
+	MessageProgress MessageKind = "progress"
+	// MessageAbort tells the worker to stop the running test, clean up and
+	// report the results gathered so far
+	MessageAbort MessageKind = "abort"
+	// MessageWorkDone carries the benchmark results back to the server
+	MessageWorkDone MessageKind = "work done"
+	// MessageFailure tells the server that the test failed on the worker.
+	// The worker reconnects afterwards to be ready for the next test
+	MessageFailure MessageKind = "failure"
+	// MessageShutdown tells the worker to exit
+	MessageShutdown MessageKind = "shutdown"
+	// MessageError tells the peer that something went wrong - the
+	// connection is usually closed afterwards
+	MessageError MessageKind = "error"
+)
+
+// Capabilities are optional protocol features a peer supports.
+// Only features supported by both sides are used on a connection
+const (
+	// CapabilityLabels means the worker advertises labels in its hello
+	CapabilityLabels = "labels"
+	// CapabilityProgress means the worker streams interval stats during a test
+	CapabilityProgress = "progress"
+	// CapabilityPrepProgress means the worker reports the progress of its preparations
+	CapabilityPrepProgress = "prep-progress"
+	// CapabilityClockSync means the worker estimates its clock offset to the
+	// server and starts the test at the time scheduled by the server
+	CapabilityClockSync = "clock-sync"
+	// CapabilityAbort means the worker listens for an abort during the test
+	CapabilityAbort = "abort"
+	// CapabilityFailure means the worker reports failures instead of just
+	// dropping the connection
+	CapabilityFailure = "failure"
+)
+
+// SupportedCapabilities lists all capabilities of this build
+var SupportedCapabilities = []string{CapabilityLabels, CapabilityProgress, CapabilityPrepProgress, CapabilityClockSync, CapabilityAbort, CapabilityFailure}
+
+// Hello is exchanged during the handshake. The worker sends its version,
+// capabilities, labels and the shared secret - the server answers with its
+// version and the negotiated capabilities
+type Hello struct {
+	Version      int
+	Capabilities []string
+	Labels       map[string]string `json:",omitempty"`
+	Token        string            `json:",omitempty"`
+	// InstanceID is the InstanceID of the worker - the server only accepts
+	// workers that send one
+	InstanceID string `json:",omitempty"`
+}
+
+// WorkerMessage is the struct that is exchanged in the communication between
+// server and worker. Kind determines which of the other fields are set
+type WorkerMessage struct {
+	Kind        MessageKind
+	Hello       *Hello      `json:",omitempty"`
+	Config      *WorkerConf `json:",omitempty"`
+	Clock       *Clock      `json:",omitempty"`
+	Schedule    *Schedule   `json:",omitempty"`
+	BenchResult BenchmarkResult
+	Progress    []*IntervalStats `json:",omitempty"`
+	PrepStats   *PrepStats       `json:",omitempty"`
+	Failure     *Failure         `json:",omitempty"`
+	Error       string           `json:",omitempty"`
+}
+
+// Phases of a test in which a worker can fail
+const (
+	PhasePreparation = "preparation"
+	PhaseStart       = "start"
+	PhaseCleanup     = "cleanup"
+	PhaseConnection  = "connection"
+)
+
+// Failure describes why a test failed on a worker
+type Failure struct {
+	WorkerID string `json:"worker_id"`
+	// Phase is one of the Phase constants
+	Phase string `json:"phase"`
+	Error string `json:"error"`
+}
+
+// PeerError is returned when the peer sent us an error message
+type PeerError struct {
+	Message string
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("peer reported an error: %s", e.Message)
+}
+
+// Connection wraps the connection between server and worker.
+// Sending is safe for concurrent use, receiving is not
+type Connection struct {
+	conn    net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+	sendMu  sync.Mutex
+	// Capabilities contains the capabilities both sides agreed on during the handshake
+	Capabilities []string
+}
+
+// NewConnection wraps the given net.Conn
+func NewConnection(conn net.Conn) *Connection {
+	return &Connection{
+		conn:    conn,
+		encoder: json.NewEncoder(conn),
+		decoder: json.NewDecoder(conn),
+	}
+}
+
+// Send sends a message to the peer
+func (c *Connection) Send(message WorkerMessage) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.encoder.Encode(message)
+}
+
+// SendError reports the given error to the peer
+func (c *Connection) SendError(err error) error {
+	return c.Send(WorkerMessage{Kind: MessageError, Error: err.Error()})
+}
+
+// Receive waits for the next message of the peer. If the peer sent an
+// error message, a *PeerError is returned
+func (c *Connection) Receive() (*WorkerMessage, error) {
+	var message WorkerMessage
+	if err := c.decoder.Decode(&message); err != nil {
+		return nil, err
+	}
+	if message.Kind == MessageError {
+		return &message, &PeerError{Message: message.Error}
+	}
+	return &message, nil
+}
+
+// Expect waits for the next message and makes sure it is of one of
+// the given kinds. Otherwise the peer is told about the unexpected message
+func (c *Connection) Expect(kinds ...MessageKind) (*WorkerMessage, error) {
+	message, err := c.Receive()
+	if err != nil {
+		return message, err
+	}
+	for _, kind := range kinds {
+		if message.Kind == kind {
+			return message, nil
+		}
+	}
+	err = fmt.Errorf("unexpected message %q - expected one of %v", message.Kind, kinds)
+	_ = c.SendError(err)
+	return message, err
+}
+
+// HasCapability checks whether a capability was negotiated for this connection
+func (c *Connection) HasCapability(capability string) bool {
+	for _, negotiated := range c.Capabilities {
+		if negotiated == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Connection) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the underlying connection
+func (c *Connection) Close() error {
+	return c.conn.Close()
+}
+
+// WorkerHandshake introduces the worker with its labels to the server
+// and waits until the server accepted it. The token is only checked by
+// the server if it requires one
+func (c *Connection) WorkerHandshake(labels map[string]string, token string) error {
+	_ = c.conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	err := c.Send(WorkerMessage{Kind: MessageHello, Hello: &Hello{
+		Version:      ProtocolVersion,
+		Capabilities: SupportedCapabilities,
+		Labels:       labels,
+		Token:        token,
+		InstanceID:   InstanceID,
+	}})
+	if err != nil {
+		return err
+	}
+	message, err := c.Expect(MessageWelcome)
+	if err != nil {
+		return err
+	}
+	if message.Hello == nil || message.Hello.Version != ProtocolVersion {
+		return fmt.Errorf("server answered with an unsupported protocol version")
+	}
+	c.Capabilities = message.Hello.Capabilities
+	return nil
+}
+
+// ServerHandshake waits for the hello of a worker, checks that it
+// speaks our protocol version and knows the shared secret (if token is set)
+// and negotiates the capabilities. It returns the hello of the worker
+func (c *Connection) ServerHandshake(token string) (*Hello, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	message, err := c.Expect(MessageHello)
+	if err != nil {
+		return nil, err
+	}
+	hello := message.Hello
+	if hello == nil {
+		err = fmt.Errorf("hello message without handshake information")
+		_ = c.SendError(err)
+		return nil, err
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(hello.Token)) != 1 {
+		err = fmt.Errorf("worker did not present the correct token")
+		_ = c.SendError(err)
+		return nil, err
+	}
+	if hello.Version != ProtocolVersion {
+		err = fmt.Errorf("protocol version mismatch - server speaks version %d, worker speaks version %d", ProtocolVersion, hello.Version)
+		_ = c.SendError(err)
+		return nil, err
+	}
+	if hello.InstanceID == "" {
+		err = fmt.Errorf("worker did not send an instance ID")
+		_ = c.SendError(err)
+		return nil, err
+	}
+	c.Capabilities = intersectCapabilities(SupportedCapabilities, hello.Capabilities)
+	err = c.Send(WorkerMessage{Kind: MessageWelcome, Hello: &Hello{
+		Version:      ProtocolVersion,
+		Capabilities: c.Capabilities,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return hello, nil
+}
+
+func intersectCapabilities(ours []string, theirs []string) []string {
+	negotiated := []string{}
+	for _, capability := range ours {
+		for _, other := range theirs {
+			if capability == other {
+				negotiated = append(negotiated, capability)
+				break
+			}
+		}
+	}
+	return negotiated
+}
@@ -0,0 +1,238 @@
+package common
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// pipe returns the server and the worker side of an in-memory connection
+func pipe(t *testing.T) (*Connection, *Connection) {
+	serverConn, workerConn := net.Pipe()
+	t.Cleanup(func() {
+		serverConn.Close()
+		workerConn.Close()
+	})
+	return NewConnection(serverConn), NewConnection(workerConn)
+}
+
+func TestHandshake(t *testing.T) {
+	server, worker := pipe(t)
+	labels := map[string]string{"hostname": "node1", "zone": "eu1"}
+
+	workerErr := make(chan error, 1)
+	go func() {
+		workerErr <- worker.WorkerHandshake(labels, "")
+	}()
+
+	hello, err := server.ServerHandshake("")
+	if err != nil {
+		t.Fatalf("ServerHandshake() error = %v", err)
+	}
+	if err := <-workerErr; err != nil {
+		t.Fatalf("WorkerHandshake() error = %v", err)
+	}
+	if hello.Version != ProtocolVersion {
+		t.Errorf("ServerHandshake() version = %d, want %d", hello.Version, ProtocolVersion)
+	}
+	if !reflect.DeepEqual(hello.Labels, labels) {
+		t.Errorf("ServerHandshake() labels = %v, want %v", hello.Labels, labels)
+	}
+	if hello.InstanceID == "" || hello.InstanceID != InstanceID {
+		t.Errorf("ServerHandshake() instance ID = %q, want %q", hello.InstanceID, InstanceID)
+	}
+	if !reflect.DeepEqual(server.Capabilities, worker.Capabilities) {
+		t.Errorf("Negotiated capabilities differ: server %v, worker %v", server.Capabilities, worker.Capabilities)
+	}
+	if !worker.HasCapability(CapabilityLabels) {
+		t.Errorf("Worker did not negotiate capability %s", CapabilityLabels)
+	}
+}
+
+func TestHandshakeCapabilityNegotiation(t *testing.T) {
+	server, worker := pipe(t)
+
+	go func() {
+		_ = worker.Send(WorkerMessage{Kind: MessageHello, Hello: &Hello{
+			Version:      ProtocolVersion,
+			Capabilities: []string{"from-the-future"},
+			InstanceID:   InstanceID,
+		}})
+		_, _ = worker.Receive()
+	}()
+
+	if _, err := server.ServerHandshake(""); err != nil {
+		t.Fatalf("ServerHandshake() error = %v", err)
+	}
+	if len(server.Capabilities) != 0 {
+		t.Errorf("ServerHandshake() negotiated %v, want no capabilities", server.Capabilities)
+	}
+}
+
+func TestHandshakeVersionMismatch(t *testing.T) {
+	server, worker := pipe(t)
+
+	workerErr := make(chan error, 1)
+	go func() {
+		err := worker.Send(WorkerMessage{Kind: MessageHello, Hello: &Hello{Version: ProtocolVersion + 1}})
+		if err != nil {
+			workerErr <- err
+			return
+		}
+		_, err = worker.Expect(MessageWelcome)
+		workerErr <- err
+	}()
+
+	if _, err := server.ServerHandshake(""); err == nil {
+		t.Errorf("ServerHandshake() accepted a worker with a different protocol version")
+	}
+	var peerErr *PeerError
+	if err := <-workerErr; !errors.As(err, &peerErr) {
+		t.Errorf("Worker got %v, want a PeerError explaining the mismatch", err)
+	}
+}
+
+func TestHandshakeWithoutInstanceID(t *testing.T) {
+	server, worker := pipe(t)
+
+	workerErr := make(chan error, 1)
+	go func() {
+		err := worker.Send(WorkerMessage{Kind: MessageHello, Hello: &Hello{Version: ProtocolVersion}})
+		if err != nil {
+			workerErr <- err
+			return
+		}
+		_, err = worker.Expect(MessageWelcome)
+		workerErr <- err
+	}()
+
+	if _, err := server.ServerHandshake(""); err == nil {
+		t.Errorf("ServerHandshake() accepted a worker without instance ID")
+	}
+	var peerErr *PeerError
+	if err := <-workerErr; !errors.As(err, &peerErr) {
+		t.Errorf("Worker got %v, want a PeerError", err)
+	}
+}
+
+func TestHandshakeToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		serverToken string
+		workerToken string
+		wantErr     bool
+	}{
+		{"no token required", "", "", false},
+		{"no token required but sent", "", "secret", false},
+		{"correct token", "secret", "secret", false},
+		{"wrong token", "secret", "guessed", true},
+		{"missing token", "secret", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, worker := pipe(t)
+
+			workerErr := make(chan error, 1)
+			go func() {
+				workerErr <- worker.WorkerHandshake(nil, tt.workerToken)
+			}()
+
+			if _, err := server.ServerHandshake(tt.serverToken); (err != nil) != tt.wantErr {
+				t.Errorf("ServerHandshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := <-workerErr; (err != nil) != tt.wantErr {
+				t.Errorf("WorkerHandshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandshakeWithoutHello(t *testing.T) {
+	server, worker := pipe(t)
+
+	workerErr := make(chan error, 1)
+	go func() {
+		_ = worker.Send(WorkerMessage{Kind: MessagePreparationsDone})
+		_, err := worker.Receive()
+		workerErr <- err
+	}()
+
+	if _, err := server.ServerHandshake(""); err == nil {
+		t.Errorf("ServerHandshake() accepted a worker that did not say hello")
+	}
+	var peerErr *PeerError
+	if err := <-workerErr; !errors.As(err, &peerErr) {
+		t.Errorf("Worker got %v, want a PeerError", err)
+	}
+}
+
+func TestProtocolExchange(t *testing.T) {
+	server, worker := pipe(t)
+	workerConf := &WorkerConf{WorkerID: "w0", Test: &TestCaseConfiguration{Name: "exchange"}}
+
+	workerErr := make(chan error, 1)
+	go func() {
+		workerErr <- func() error {
+			if err := worker.WorkerHandshake(nil, ""); err != nil {
+				return err
+			}
+			message, err := worker.Expect(MessageInit)
+			if err != nil {
+				return err
+			}
+			if err := worker.Send(WorkerMessage{Kind: MessagePreparationsDone}); err != nil {
+				return err
+			}
+			if _, err := worker.Expect(MessageStartWork); err != nil {
+				return err
+			}
+			return worker.Send(WorkerMessage{Kind: MessageWorkDone, BenchResult: BenchmarkResult{
+				TestName:   message.Config.Test.Name,
+				Operations: 42,
+			}})
+		}()
+	}()
+
+	if _, err := server.ServerHandshake(""); err != nil {
+		t.Fatalf("ServerHandshake() error = %v", err)
+	}
+	if err := server.Send(WorkerMessage{Kind: MessageInit, Config: workerConf}); err != nil {
+		t.Fatalf("Send(init) error = %v", err)
+	}
+	if _, err := server.Expect(MessagePreparationsDone); err != nil {
+		t.Fatalf("Expect(preparations done) error = %v", err)
+	}
+	if err := server.Send(WorkerMessage{Kind: MessageStartWork}); err != nil {
+		t.Fatalf("Send(start work) error = %v", err)
+	}
+	message, err := server.Expect(MessageWorkDone)
+	if err != nil {
+		t.Fatalf("Expect(work done) error = %v", err)
+	}
+	if message.BenchResult.TestName != "exchange" || message.BenchResult.Operations != 42 {
+		t.Errorf("Got bench result %+v, want test exchange with 42 operations", message.BenchResult)
+	}
+	if err := <-workerErr; err != nil {
+		t.Errorf("Worker side error = %v", err)
+	}
+}
+
+func TestExpectUnexpectedMessage(t *testing.T) {
+	server, worker := pipe(t)
+
+	workerErr := make(chan error, 1)
+	go func() {
+		_ = worker.Send(WorkerMessage{Kind: MessageShutdown})
+		_, err := worker.Receive()
+		workerErr <- err
+	}()
+
+	if _, err := server.Expect(MessageWorkDone); err == nil {
+		t.Errorf("Expect() accepted an unexpected message kind")
+	}
+	var peerErr *PeerError
+	if err := <-workerErr; !errors.As(err, &peerErr) {
+		t.Errorf("Peer got %v, want a PeerError about the unexpected message", err)
+	}
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"sort"
+	"time"
+)
+
+// MethodStats contains the measurements of one S3 method (GET, PUT, ...)
+type MethodStats struct {
+	Operations uint64    `json:"operations"`
+	Errors     uint64    `json:"errors"`
+	Bytes      uint64    `json:"bytes"`
+	Latency    Histogram `json:"latency"`
+	// Keys and Pages are the number of listed keys and pages of list operations
+	Keys  uint64 `json:"keys,omitempty"`
+	Pages uint64 `json:"pages,omitempty"`
+}
+
+// Merge adds the measurements of other to these stats
+func (s *MethodStats) Merge(other *MethodStats) {
+	s.Operations += other.Operations
+	s.Errors += other.Errors
+	s.Bytes += other.Bytes
+	s.Keys += other.Keys
+	s.Pages += other.Pages
+	s.Latency.Merge(&other.Latency)
+}
+
+// IntervalStats contains the measurements of one interval of a test.
+// Workers send these periodically while a test is running - the server
+// merges the intervals with the same index of all workers
+type IntervalStats struct {
+	// Index is the number of the interval since the start of the test
+	Index    int                     `json:"index"`
+	Start    time.Time               `json:"start"`
+	Duration time.Duration           `json:"duration"`
+	Methods  map[string]*MethodStats `json:"methods"`
+}
+
+// Merge adds the measurements of other to this interval
+func (s *IntervalStats) Merge(other *IntervalStats) {
+	if s.Methods == nil {
+		s.Methods = map[string]*MethodStats{}
+	}
+	if s.Start.IsZero() || (!other.Start.IsZero() && other.Start.Before(s.Start)) {
+		s.Start = other.Start
+	}
+	if other.Duration > s.Duration {
+		s.Duration = other.Duration
+	}
+	for method, stats := range other.Methods {
+		if _, ok := s.Methods[method]; !ok {
+			s.Methods[method] = &MethodStats{}
+		}
+		s.Methods[method].Merge(stats)
+	}
+}
+
+// Total merges the stats of all methods
+func (s *IntervalStats) Total() MethodStats {
+	total := MethodStats{}
+	for _, stats := range s.Methods {
+		total.Merge(stats)
+	}
+	return total
+}
+
+// MethodNames returns the names of all methods in a stable order
+func (s *IntervalStats) MethodNames() []string {
+	methods := make([]string, 0, len(s.Methods))
+	for method := range s.Methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// MergeTimelines merges the timelines of several workers into a cluster
+// wide timeline. Intervals with the same index are merged
+func MergeTimelines(timelines ...[]*IntervalStats) []*IntervalStats {
+	merged := map[int]*IntervalStats{}
+	for _, timeline := range timelines {
+		for _, interval := range timeline {
+			if _, ok := merged[interval.Index]; !ok {
+				merged[interval.Index] = &IntervalStats{Index: interval.Index}
+			}
+			merged[interval.Index].Merge(interval)
+		}
+	}
+	result := make([]*IntervalStats, 0, len(merged))
+	for _, interval := range merged {
+		result = append(result, interval)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Index < result[j].Index
+	})
+	return result
+}
+
+// TimelineWindow returns the intervals that lie completely within the
+// timeline after cutting off skipStart at its beginning and skipEnd at its end
+func TimelineWindow(timeline []*IntervalStats, skipStart time.Duration, skipEnd time.Duration) []*IntervalStats {
+	if len(timeline) == 0 {
+		return nil
+	}
+	windowStart := timeline[0].Start.Add(skipStart)
+	last := timeline[len(timeline)-1]
+	windowEnd := last.Start.Add(last.Duration).Add(-skipEnd)
+
+	var window []*IntervalStats
+	for _, interval := range timeline {
+		if interval.Start.Before(windowStart) || interval.Start.Add(interval.Duration).After(windowEnd) {
+			continue
+		}
+		window = append(window, interval)
+	}
+	return window
+}
+
+// SumIntervals merges consecutive intervals into a single one that
+// spans from the start of the first to the end of the last interval
+func SumIntervals(intervals []*IntervalStats) IntervalStats {
+	sum := IntervalStats{Methods: map[string]*MethodStats{}}
+	var end time.Time
+	for _, interval := range intervals {
+		sum.Merge(interval)
+		if intervalEnd := interval.Start.Add(interval.Duration); intervalEnd.After(end) {
+			end = intervalEnd
+		}
+	}
+	if len(intervals) > 0 {
+		sum.Index = intervals[0].Index
+		sum.Duration = end.Sub(sum.Start)
+	}
+	return sum
+}
+
+// PrepStats describes the progress and the throughput of the preparation
+// of a test. Workers send it periodically while preparing - the final
+// stats are part of the results
+type PrepStats struct {
+	// Objects is the number of objects that were uploaded successfully
+	Objects      uint64        `json:"objects"`
+	Errors       uint64        `json:"errors"`
+	TotalObjects uint64        `json:"total_objects"`
+	Bytes        uint64        `json:"bytes"`
+	TotalBytes   uint64        `json:"total_bytes"`
+	Duration     time.Duration `json:"duration"`
+}
+
+// Merge adds the preparation of another worker. All workers prepare at
+// the same time, so the longest duration is kept
+func (s *PrepStats) Merge(other *PrepStats) {
+	s.Objects += other.Objects
+	s.Errors += other.Errors
+	s.TotalObjects += other.TotalObjects
+	s.Bytes += other.Bytes
+	s.TotalBytes += other.TotalBytes
+	if other.Duration > s.Duration {
+		s.Duration = other.Duration
+	}
+}
+
+// Bandwidth returns the uploaded Bytes per second
+func (s *PrepStats) Bandwidth() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// Remaining estimates the time until all objects are uploaded from the
+// throughput so far. It is zero when nothing was uploaded yet
+func (s *PrepStats) Remaining() time.Duration {
+	done, total := s.Bytes, s.TotalBytes
+	if total == 0 {
+		done, total = s.Objects+s.Errors, s.TotalObjects
+	}
+	if done == 0 || done >= total {
+		return 0
+	}
+	return time.Duration(float64(s.Duration) * float64(total-done) / float64(done))
+}
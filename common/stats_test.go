@@ -0,0 +1,122 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalStats_Merge(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := &IntervalStats{Index: 3, Start: start.Add(time.Second), Duration: time.Second, Methods: map[string]*MethodStats{
+		"GET": {Operations: 10, Bytes: 100},
+	}}
+	second := &IntervalStats{Index: 3, Start: start, Duration: 2 * time.Second, Methods: map[string]*MethodStats{
+		"GET":  {Operations: 5, Errors: 1, Bytes: 50},
+		"PUT":  {Operations: 1, Bytes: 10},
+		"LIST": {Operations: 2, Keys: 2000, Pages: 3},
+	}}
+	merged := &IntervalStats{Index: 3}
+	merged.Merge(first)
+	merged.Merge(second)
+
+	if !merged.Start.Equal(start) || merged.Duration != 2*time.Second {
+		t.Errorf("Merge() start %v duration %v, want %v and 2s", merged.Start, merged.Duration, start)
+	}
+	if get := merged.Methods["GET"]; get.Operations != 15 || get.Errors != 1 || get.Bytes != 150 {
+		t.Errorf("Merge() GET = %+v, want 15 ops 1 error 150 bytes", get)
+	}
+	if list := merged.Methods["LIST"]; list.Keys != 2000 || list.Pages != 3 {
+		t.Errorf("Merge() LIST = %+v, want 2000 keys and 3 pages", list)
+	}
+	if total := merged.Total(); total.Operations != 18 || total.Bytes != 160 {
+		t.Errorf("Total() = %+v, want 18 ops and 160 bytes", total)
+	}
+	if methods := merged.MethodNames(); len(methods) != 3 || methods[0] != "GET" || methods[1] != "LIST" || methods[2] != "PUT" {
+		t.Errorf("MethodNames() = %v, want [GET LIST PUT]", methods)
+	}
+	// The merged input must not be modified
+	if first.Methods["GET"].Operations != 10 {
+		t.Errorf("Merge() modified its input")
+	}
+}
+
+// timeline creates a timeline of 1s intervals with the given operations per interval
+func timeline(start time.Time, operations ...uint64) []*IntervalStats {
+	var result []*IntervalStats
+	for index, ops := range operations {
+		result = append(result, &IntervalStats{
+			Index:    index,
+			Start:    start.Add(time.Duration(index) * time.Second),
+			Duration: time.Second,
+			Methods:  map[string]*MethodStats{"GET": {Operations: ops, Bytes: ops * 10}},
+		})
+	}
+	return result
+}
+
+func TestMergeTimelines(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	merged := MergeTimelines(timeline(start, 1, 2, 3), timeline(start, 10, 20), nil)
+	if len(merged) != 3 {
+		t.Fatalf("MergeTimelines() returned %d intervals, want 3", len(merged))
+	}
+	for i, want := range []uint64{11, 22, 3} {
+		if merged[i].Index != i || merged[i].Methods["GET"].Operations != want {
+			t.Errorf("MergeTimelines()[%d] = index %d with %d ops, want index %d with %d ops", i, merged[i].Index, merged[i].Methods["GET"].Operations, i, want)
+		}
+	}
+}
+
+func TestTimelineWindow(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		skipStart time.Duration
+		skipEnd   time.Duration
+		wantOps   uint64
+		wantSpan  time.Duration
+	}{
+		{"nothing skipped", 0, 0, 15, 5 * time.Second},
+		{"warm-up skipped", 2 * time.Second, 0, 12, 3 * time.Second},
+		{"cool-down skipped", 0, time.Second, 10, 4 * time.Second},
+		{"partial intervals are dropped", 1500 * time.Millisecond, 1500 * time.Millisecond, 3, time.Second},
+		{"everything skipped", 3 * time.Second, 3 * time.Second, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum := SumIntervals(TimelineWindow(timeline(start, 1, 2, 3, 4, 5), tt.skipStart, tt.skipEnd))
+			if total := sum.Total(); total.Operations != tt.wantOps || sum.Duration != tt.wantSpan {
+				t.Errorf("SumIntervals(TimelineWindow()) = %d ops over %v, want %d ops over %v", total.Operations, sum.Duration, tt.wantOps, tt.wantSpan)
+			}
+		})
+	}
+}
+
+func TestPrepStats(t *testing.T) {
+	stats := &PrepStats{Objects: 10, TotalObjects: 40, Bytes: 10 * MEGABYTE, TotalBytes: 40 * MEGABYTE, Duration: 2 * time.Second}
+	stats.Merge(&PrepStats{Objects: 30, Errors: 1, TotalObjects: 40, Bytes: 30 * MEGABYTE, TotalBytes: 40 * MEGABYTE, Duration: 4 * time.Second})
+	if stats.Objects != 40 || stats.Errors != 1 || stats.TotalObjects != 80 || stats.Duration != 4*time.Second {
+		t.Fatalf("Merge() = %+v", stats)
+	}
+	if got := stats.Bandwidth(); got != 10*MEGABYTE {
+		t.Errorf("Bandwidth() = %v, want 10 MiB/s", got)
+	}
+
+	tests := []struct {
+		name  string
+		stats PrepStats
+		want  time.Duration
+	}{
+		{"by bytes", PrepStats{Objects: 1, TotalObjects: 4, Bytes: 25, TotalBytes: 100, Duration: time.Second}, 3 * time.Second},
+		{"by objects without bytes", PrepStats{Objects: 2, Errors: 2, TotalObjects: 8, Duration: time.Second}, time.Second},
+		{"nothing done yet", PrepStats{TotalObjects: 4, TotalBytes: 100, Duration: time.Second}, 0},
+		{"all done", PrepStats{Objects: 4, TotalObjects: 4, Bytes: 100, TotalBytes: 100, Duration: time.Second}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.Remaining(); got != tt.want {
+				t.Errorf("Remaining() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
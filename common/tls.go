@@ -0,0 +1,76 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// ServerTLSConfig builds the TLS config for the server side of the
+// connection between server and workers. When clientCAFile is set,
+// workers have to present a certificate signed by that CA
+func ServerTLSConfig(certFile string, keyFile string, clientCAFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// WorkerTLSConfig builds the TLS config for the worker side. The server
+// certificate is verified against caFile or the system roots if caFile
+// is empty. certFile and keyFile are only needed when the server verifies
+// client certificates
+func WorkerTLSConfig(caFile string, certFile string, keyFile string, serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load worker certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	caContent, err := ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caContent) {
+		return nil, fmt.Errorf("Could not find any PEM encoded certificate in %s", caFile)
+	}
+	return pool, nil
+}
+
+// TokenFromEnv returns the shared secret from the GOSBENCH_TOKEN environment
+// variable. It is used as default for the token flags, so that the secret
+// does not need to show up in the process list
+func TokenFromEnv() string {
+	return os.Getenv("GOSBENCH_TOKEN")
+}
@@ -0,0 +1,150 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate creates a certificate signed by parent (or self-signed
+// if parent is nil) and writes it and its key as PEM files to dir
+func writeCertificate(t *testing.T, dir string, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// writePKI creates a CA with a server and a worker certificate
+func writePKI(t *testing.T) string {
+	dir := t.TempDir()
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey := writeCertificate(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gosbench CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	writeCertificate(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "gosbench-server"},
+		DNSNames:     []string{"gosbench-server"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCertificate(t, dir, "worker", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "gosbench-worker"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	return dir
+}
+
+func TestTLSHandshake(t *testing.T) {
+	dir := writePKI(t)
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		name       string
+		clientCA   string
+		workerCert string
+		workerKey  string
+		serverName string
+		wantErr    bool
+	}{
+		{"server certificate only", "", "", "", "gosbench-server", false},
+		{"client certificate verified", file("ca.crt"), file("worker.crt"), file("worker.key"), "gosbench-server", false},
+		{"client certificate missing", file("ca.crt"), "", "", "gosbench-server", true},
+		{"wrong server name", "", "", "", "somebody-else", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConfig, err := ServerTLSConfig(file("server.crt"), file("server.key"), tt.clientCA)
+			if err != nil {
+				t.Fatalf("ServerTLSConfig() error = %v", err)
+			}
+			workerConfig, err := WorkerTLSConfig(file("ca.crt"), tt.workerCert, tt.workerKey, tt.serverName)
+			if err != nil {
+				t.Fatalf("WorkerTLSConfig() error = %v", err)
+			}
+
+			// Use a real TCP connection - the TLS alerts would block on a synchronous pipe
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					serverErr <- err
+					return
+				}
+				defer conn.Close()
+				serverErr <- conn.(*tls.Conn).Handshake()
+			}()
+			worker, workerErr := tls.Dial("tcp", listener.Addr().String(), workerConfig)
+			if workerErr == nil {
+				defer worker.Close()
+			}
+			if err := <-serverErr; (err != nil) != tt.wantErr {
+				t.Errorf("Server Handshake() error = %v, wantErr %v (worker error: %v)", err, tt.wantErr, workerErr)
+			}
+		})
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := writePKI(t)
+	if _, err := ServerTLSConfig(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "server.key"), ""); err == nil {
+		t.Errorf("ServerTLSConfig() accepted a missing certificate")
+	}
+	if _, err := ServerTLSConfig(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "server.key")); err == nil {
+		t.Errorf("ServerTLSConfig() accepted a CA file without certificates")
+	}
+	if _, err := WorkerTLSConfig("", filepath.Join(dir, "worker.crt"), "", ""); err == nil {
+		t.Errorf("WorkerTLSConfig() accepted a certificate without key")
+	}
+}
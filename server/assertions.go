@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// assertionResult is the outcome of checking one threshold of a test
+type assertionResult struct {
+	Assertion string  `json:"assertion"`
+	Limit     float64 `json:"limit"`
+	Value     float64 `json:"value"`
+	Passed    bool    `json:"passed"`
+}
+
+func (r assertionResult) String() string {
+	status := "PASSED"
+	if !r.Passed {
+		status = "FAILED"
+	}
+	return fmt.Sprintf("%s: %s is %.4g (limit %.4g)", status, r.Assertion, r.Value, r.Limit)
+}
+
+// evaluateAssertions checks the aggregated results of a test against its
+// thresholds. The latencies and errors are taken from the measured window
+// of the timeline
+func evaluateAssertions(assert common.Assertions, summary common.BenchmarkResult, window common.IntervalStats) []assertionResult {
+	var results []assertionResult
+	if assert.MinOpsPerSecond > 0 {
+		opsPerSecond := float64(0)
+		if summary.Duration > 0 {
+			opsPerSecond = summary.Operations / summary.Duration.Seconds()
+		}
+		results = append(results, assertionResult{
+			Assertion: "ops/s",
+			Limit:     assert.MinOpsPerSecond,
+			Value:     opsPerSecond,
+			Passed:    opsPerSecond >= assert.MinOpsPerSecond,
+		})
+	}
+	if assert.MinMiBPerSecond > 0 {
+		bandwidth := summary.Bandwidth / common.MEGABYTE
+		results = append(results, assertionResult{
+			Assertion: "MiB/s",
+			Limit:     assert.MinMiBPerSecond,
+			Value:     bandwidth,
+			Passed:    bandwidth >= assert.MinMiBPerSecond,
+		})
+	}
+	methods := make([]string, 0, len(assert.MaxP99Latency))
+	for method := range assert.MaxP99Latency {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	total := window.Total()
+	for _, method := range methods {
+		stats := &total
+		if method != "TOTAL" {
+			stats = window.Methods[method]
+		}
+		result := assertionResult{
+			Assertion: fmt.Sprintf("%s p99 latency in ms", method),
+			Limit:     assert.MaxP99Latency[method],
+		}
+		// A method without any operations can not meet its latency goal
+		if stats != nil && stats.Latency.Count > 0 {
+			result.Value = stats.Latency.Quantile(0.99)
+			result.Passed = result.Value <= result.Limit
+		}
+		results = append(results, result)
+	}
+	if assert.MaxErrorRate != nil {
+		errorRate := float64(0)
+		if all := total.Operations + total.Errors; all > 0 {
+			errorRate = float64(total.Errors) / float64(all)
+		}
+		results = append(results, assertionResult{
+			Assertion: "error rate",
+			Limit:     *assert.MaxErrorRate,
+			Value:     errorRate,
+			Passed:    errorRate <= *assert.MaxErrorRate,
+		})
+	}
+	return results
+}
+
+// assertionsPassed returns true when all assertions passed
+func assertionsPassed(results []assertionResult) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
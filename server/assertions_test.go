@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_evaluateAssertions(t *testing.T) {
+	get := &common.MethodStats{Operations: 99, Errors: 1}
+	for i := 0; i < 100; i++ {
+		get.Latency.Observe(10)
+	}
+	window := common.IntervalStats{Methods: map[string]*common.MethodStats{"GET": get}}
+	summary := common.BenchmarkResult{Operations: 1000, Bandwidth: 10 * common.MEGABYTE, Duration: 10 * time.Second}
+	errorRate := func(rate float64) *float64 { return &rate }
+
+	tests := []struct {
+		name       string
+		assert     common.Assertions
+		wantPassed []bool
+	}{
+		{"No assertions", common.Assertions{}, nil},
+		{"Throughput met", common.Assertions{MinOpsPerSecond: 100, MinMiBPerSecond: 10}, []bool{true, true}},
+		{"Throughput missed", common.Assertions{MinOpsPerSecond: 101, MinMiBPerSecond: 11}, []bool{false, false}},
+		{"Latency per method", common.Assertions{MaxP99Latency: map[string]float64{"GET": 11, "TOTAL": 5}}, []bool{true, false}},
+		{"Latency of method without operations", common.Assertions{MaxP99Latency: map[string]float64{"PUT": 100}}, []bool{false}},
+		{"Error rate met", common.Assertions{MaxErrorRate: errorRate(0.01)}, []bool{true}},
+		{"No errors allowed", common.Assertions{MaxErrorRate: errorRate(0)}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := evaluateAssertions(tt.assert, summary, window)
+			if len(results) != len(tt.wantPassed) {
+				t.Fatalf("evaluateAssertions() returned %d results, want %d", len(results), len(tt.wantPassed))
+			}
+			for i, result := range results {
+				if result.Passed != tt.wantPassed[i] {
+					t.Errorf("evaluateAssertions() %s", result)
+				}
+			}
+			wantAllPassed := true
+			for _, passed := range tt.wantPassed {
+				wantAllPassed = wantAllPassed && passed
+			}
+			if got := assertionsPassed(results); got != wantAllPassed {
+				t.Errorf("assertionsPassed() = %v, want %v", got, wantAllPassed)
+			}
+		})
+	}
+}
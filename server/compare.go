@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// metricComparison compares one metric of a test with its baseline
+type metricComparison struct {
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	// Delta is the relative change to the baseline - 0.1 means 10% more
+	Delta      float64 `json:"delta"`
+	Regression bool    `json:"regression"`
+}
+
+// testComparison compares all metrics of a test with its baseline
+type testComparison struct {
+	Test    string             `json:"test"`
+	Metrics []metricComparison `json:"metrics"`
+}
+
+// Regressions returns the number of metrics that got worse than the tolerance allows
+func (c *testComparison) Regressions() int {
+	regressions := 0
+	for _, metric := range c.Metrics {
+		if metric.Regression {
+			regressions++
+		}
+	}
+	return regressions
+}
+
+// compareResults compares the throughput and latencies of a test with its
+// baseline. A metric regressed when it got worse by more than tolerance
+// (0.05 = 5%). Metrics that are missing in one of the results are skipped
+func compareResults(baseline common.BenchmarkResult, current common.BenchmarkResult, tolerance float64) *testComparison {
+	comparison := &testComparison{Test: current.TestName}
+	metrics := []struct {
+		name           string
+		baseline       float64
+		current        float64
+		higherIsBetter bool
+	}{
+		{"ops/s", opsPerSecond(baseline), opsPerSecond(current), true},
+		{"bandwidth", baseline.Bandwidth, current.Bandwidth, true},
+		{"avg latency", baseline.LatencyAvg, current.LatencyAvg, false},
+		{"p50 latency", baseline.LatencyP50, current.LatencyP50, false},
+		{"p90 latency", baseline.LatencyP90, current.LatencyP90, false},
+		{"p99 latency", baseline.LatencyP99, current.LatencyP99, false},
+	}
+	for _, metric := range metrics {
+		if metric.baseline == 0 || metric.current == 0 {
+			continue
+		}
+		delta := (metric.current - metric.baseline) / metric.baseline
+		regression := delta > tolerance
+		if metric.higherIsBetter {
+			regression = -delta > tolerance
+		}
+		comparison.Metrics = append(comparison.Metrics, metricComparison{
+			Metric:     metric.name,
+			Baseline:   metric.baseline,
+			Current:    metric.current,
+			Delta:      delta,
+			Regression: regression,
+		})
+	}
+	return comparison
+}
+
+func opsPerSecond(result common.BenchmarkResult) float64 {
+	if result.Duration <= 0 {
+		return 0
+	}
+	return result.Operations / result.Duration.Seconds()
+}
+
+// logComparison logs the comparison of a test - regressions as error
+func logComparison(comparison *testComparison) {
+	for _, metric := range comparison.Metrics {
+		entry := log.WithField("test", comparison.Test).
+			WithField("baseline", metric.Baseline).
+			WithField("current", metric.Current).
+			WithField("delta", fmt.Sprintf("%+.1f%%", metric.Delta*100))
+		if metric.Regression {
+			entry.Errorf("REGRESSION of %s", metric.Metric)
+		} else {
+			entry.Infof("Compared %s to baseline", metric.Metric)
+		}
+	}
+}
+
+// printComparisons prints a table of all comparisons
+func printComparisons(out io.Writer, comparisons []*testComparison) {
+	fmt.Fprintf(out, "%-30s %-12s %16s %16s %9s\n", "TEST", "METRIC", "BASELINE", "CURRENT", "DELTA")
+	for _, comparison := range comparisons {
+		for _, metric := range comparison.Metrics {
+			marker := ""
+			if metric.Regression {
+				marker = "REGRESSION"
+			}
+			fmt.Fprintf(out, "%-30s %-12s %16.2f %16.2f %+8.1f%% %s\n", comparison.Test, metric.Metric, metric.Baseline, metric.Current, metric.Delta*100, marker)
+		}
+	}
+}
+
+// loadResults reads the summaries of all tests from a JSON report or a
+// CSV result file of an earlier run. Tests that appear more than once,
+// e.g. in a CSV that was appended to by several runs, use the latest result
+func loadResults(path string) (map[string]common.BenchmarkResult, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		return readCSVResults(file)
+	}
+	return readReportResults(file)
+}
+
+func readReportResults(reader io.Reader) (map[string]common.BenchmarkResult, []string, error) {
+	report := runReport{}
+	if err := json.NewDecoder(reader).Decode(&report); err != nil {
+		return nil, nil, fmt.Errorf("Could not parse JSON results: %w", err)
+	}
+	results := map[string]common.BenchmarkResult{}
+	var order []string
+	for _, test := range report.Tests {
+		if test.Aborted {
+			// An interrupted test has no results to compare
+			log.WithField("test", test.Name).Warning("Test was aborted - skipping its results")
+			continue
+		}
+		if _, ok := results[test.Name]; !ok {
+			order = append(order, test.Name)
+		}
+		summary := test.Summary
+		summary.TestName = test.Name
+		results[test.Name] = summary
+	}
+	return results, order, nil
+}
+
+// readCSVResults reads the CSV that writeResultToCSV writes
+func readCSVResults(reader io.Reader) (map[string]common.BenchmarkResult, []string, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not parse CSV results: %w", err)
+	}
+	results := map[string]common.BenchmarkResult{}
+	var order []string
+	for i, record := range records {
+		if i == 0 && record[0] == "testName" {
+			continue
+		}
+		if len(record) < 6 {
+			return nil, nil, fmt.Errorf("Line %d of the CSV results has %d instead of 6 columns", i+1, len(record))
+		}
+		values := make([]float64, 5)
+		for column := range values {
+			values[column], err = strconv.ParseFloat(record[column+1], 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Line %d of the CSV results: %w", i+1, err)
+			}
+		}
+		if _, ok := results[record[0]]; !ok {
+			order = append(order, record[0])
+		}
+		results[record[0]] = common.BenchmarkResult{
+			TestName:   record[0],
+			Operations: values[0],
+			Bytes:      values[1],
+			Bandwidth:  values[2],
+			LatencyAvg: values[3],
+			Duration:   time.Duration(values[4] * float64(time.Second)),
+		}
+	}
+	return results, order, nil
+}
+
+// runCompare implements the compare subcommand, which compares two result
+// files without running any test. It returns the exit code
+func runCompare(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	baselineFile := flags.String("baseline", "", "Results of the baseline run (JSON or CSV)")
+	tolerance := flags.Float64("tolerance", 0.05, "Relative change (0.05 = 5%) up to which a worse metric is no regression")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s compare -baseline old.json [-tolerance 0.05] new.json\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if *baselineFile == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	baseline, _, err := loadResults(*baselineFile)
+	if err != nil {
+		log.WithError(err).WithField("file", *baselineFile).Error("Could not load the baseline")
+		return 2
+	}
+	current, order, err := loadResults(flags.Arg(0))
+	if err != nil {
+		log.WithError(err).WithField("file", flags.Arg(0)).Error("Could not load the results")
+		return 2
+	}
+
+	var comparisons []*testComparison
+	regressions := 0
+	for _, name := range order {
+		baselineResult, ok := baseline[name]
+		if !ok {
+			log.WithField("test", name).Warning("Test is not part of the baseline - skipping")
+			continue
+		}
+		comparison := compareResults(baselineResult, current[name], *tolerance)
+		regressions += comparison.Regressions()
+		comparisons = append(comparisons, comparison)
+	}
+	printComparisons(os.Stdout, comparisons)
+	if regressions > 0 {
+		log.WithField("regressions", regressions).Error("Found regressions compared to the baseline")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_compareResults(t *testing.T) {
+	baseline := common.BenchmarkResult{TestName: "test", Operations: 1000, Bandwidth: 100, LatencyAvg: 10, LatencyP99: 20, Duration: 10 * time.Second}
+	tests := []struct {
+		name            string
+		current         common.BenchmarkResult
+		wantMetrics     int
+		wantRegressions int
+	}{
+		{"Unchanged", baseline, 4, 0},
+		{"Within tolerance", common.BenchmarkResult{Operations: 960, Bandwidth: 96, LatencyAvg: 10.4, LatencyP99: 20.8, Duration: 10 * time.Second}, 4, 0},
+		{"Faster is no regression", common.BenchmarkResult{Operations: 2000, Bandwidth: 200, LatencyAvg: 5, LatencyP99: 10, Duration: 10 * time.Second}, 4, 0},
+		{"Throughput dropped", common.BenchmarkResult{Operations: 900, Bandwidth: 90, LatencyAvg: 10, LatencyP99: 20, Duration: 10 * time.Second}, 4, 2},
+		{"Tail latency grew", common.BenchmarkResult{Operations: 1000, Bandwidth: 100, LatencyAvg: 10, LatencyP99: 30, Duration: 10 * time.Second}, 4, 1},
+		{"Missing percentiles are skipped", common.BenchmarkResult{Operations: 1000, Bandwidth: 100, LatencyAvg: 10, Duration: 10 * time.Second}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparison := compareResults(baseline, tt.current, 0.05)
+			if len(comparison.Metrics) != tt.wantMetrics {
+				t.Errorf("compareResults() compared %d metrics, want %d", len(comparison.Metrics), tt.wantMetrics)
+			}
+			if got := comparison.Regressions(); got != tt.wantRegressions {
+				t.Errorf("compareResults() found %d regressions, want %d: %+v", got, tt.wantRegressions, comparison.Metrics)
+			}
+		})
+	}
+}
+
+func Test_readCSVResults(t *testing.T) {
+	csv := `testName,Total Operations,Total Bytes,Average Bandwidth in Bytes/s,Average Latency in ms,Test duration seen by server in seconds
+read,1000,4096000,409600.000000,12.500000,10.000000
+write,500,2048000,204800.000000,25.000000,10.000000
+read,2000,8192000,819200.000000,6.250000,10.000000
+`
+	results, order, err := readCSVResults(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("readCSVResults() error = %v", err)
+	}
+	if len(order) != 2 || order[0] != "read" || order[1] != "write" {
+		t.Errorf("readCSVResults() order = %v, want [read write]", order)
+	}
+	// The latest result of a test wins
+	if read := results["read"]; read.Operations != 2000 || read.LatencyAvg != 6.25 || read.Duration != 10*time.Second {
+		t.Errorf("readCSVResults() read = %+v, want the second run", read)
+	}
+
+	if _, _, err := readCSVResults(strings.NewReader("read,1000,nope,1,1,1\n")); err == nil {
+		t.Errorf("readCSVResults() expected an error for a malformed number")
+	}
+}
+
+func Test_loadResultsFromReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	report := &runReport{Tests: []*testReport{
+		{Name: "read", Summary: common.BenchmarkResult{Operations: 1000, LatencyP99: 20, Duration: 10 * time.Second}},
+		{Name: "write", Aborted: true, Summary: common.BenchmarkResult{Operations: 10, Duration: time.Second}},
+		{Name: "read", Aborted: true, Summary: common.BenchmarkResult{Operations: 10, LatencyP99: 5, Duration: time.Second}},
+	}}
+	if err := writeReport(path, report); err != nil {
+		t.Fatalf("writeReport() error = %v", err)
+	}
+	results, order, err := loadResults(path)
+	if err != nil {
+		t.Fatalf("loadResults() error = %v", err)
+	}
+	if len(order) != 1 || results["read"].TestName != "read" || results["read"].LatencyP99 != 20 || results["read"].Duration != 10*time.Second {
+		t.Errorf("loadResults() = %+v, want the summary of the report", results)
+	}
+	if _, ok := results["write"]; ok || len(results) != 1 {
+		t.Errorf("loadResults() = %+v, want no results of aborted tests", results)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// workerDeviation contains the relative deviation of one worker from the
+// mean of all workers of a test - e.g. -0.5 means half of the mean
+type workerDeviation struct {
+	WorkerID   string  `json:"worker_id"`
+	Operations float64 `json:"operations"`
+	Bandwidth  float64 `json:"bandwidth"`
+	Latency    float64 `json:"latency"`
+	// Outlier is set when any of the deviations exceeds the threshold
+	Outlier bool `json:"outlier"`
+}
+
+// imbalanceReport shows how evenly the load was spread across the workers
+type imbalanceReport struct {
+	Threshold float64 `json:"threshold"`
+	// FairnessIndex is Jain's fairness index of the operations per worker.
+	// It is 1 when all workers did the same amount of operations and
+	// approaches 1/n when a single worker did all of them
+	FairnessIndex float64           `json:"fairness_index"`
+	Workers       []workerDeviation `json:"workers"`
+}
+
+// analyzeImbalance compares the results of all workers with their mean and
+// flags the workers that deviate by more than threshold (0.25 = 25%)
+func analyzeImbalance(results []common.BenchmarkResult, threshold float64) imbalanceReport {
+	report := imbalanceReport{Threshold: threshold}
+	if len(results) == 0 {
+		return report
+	}
+	operations := make([]float64, len(results))
+	bandwidths := make([]float64, len(results))
+	latencies := make([]float64, len(results))
+	for i, result := range results {
+		operations[i] = result.Operations
+		bandwidths[i] = result.Bandwidth
+		latencies[i] = result.LatencyAvg
+	}
+	report.FairnessIndex = jainFairnessIndex(operations)
+
+	meanOperations, meanBandwidth, meanLatency := mean(operations), mean(bandwidths), mean(latencies)
+	for i, result := range results {
+		deviation := workerDeviation{
+			WorkerID:   result.WorkerID,
+			Operations: relativeDeviation(operations[i], meanOperations),
+			Bandwidth:  relativeDeviation(bandwidths[i], meanBandwidth),
+			Latency:    relativeDeviation(latencies[i], meanLatency),
+		}
+		deviation.Outlier = math.Abs(deviation.Operations) > threshold ||
+			math.Abs(deviation.Bandwidth) > threshold ||
+			math.Abs(deviation.Latency) > threshold
+		report.Workers = append(report.Workers, deviation)
+	}
+	return report
+}
+
+// jainFairnessIndex calculates (sum x)^2 / (n * sum x^2)
+func jainFairnessIndex(values []float64) float64 {
+	sum, squares := float64(0), float64(0)
+	for _, value := range values {
+		sum += value
+		squares += value * value
+	}
+	if squares == 0 {
+		// Nobody did anything - which is perfectly fair
+		return 1
+	}
+	return sum * sum / (float64(len(values)) * squares)
+}
+
+func mean(values []float64) float64 {
+	sum := float64(0)
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+func relativeDeviation(value float64, mean float64) float64 {
+	if mean == 0 {
+		return 0
+	}
+	return (value - mean) / mean
+}
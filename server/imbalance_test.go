@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_jainFairnessIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"Equal", []float64{100, 100, 100, 100}, 1},
+		{"Single worker did everything", []float64{100, 0, 0, 0}, 0.25},
+		{"One worker at half", []float64{100, 50}, 0.9},
+		{"Nothing done", []float64{0, 0}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jainFairnessIndex(tt.values); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("jainFairnessIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_analyzeImbalance(t *testing.T) {
+	results := []common.BenchmarkResult{
+		{WorkerID: "w0", Operations: 1000, Bandwidth: 100, LatencyAvg: 10},
+		{WorkerID: "w1", Operations: 1000, Bandwidth: 100, LatencyAvg: 10},
+		{WorkerID: "w2", Operations: 1000, Bandwidth: 100, LatencyAvg: 10},
+		// The straggler with a bad NIC
+		{WorkerID: "w3", Operations: 500, Bandwidth: 50, LatencyAvg: 20},
+	}
+	report := analyzeImbalance(results, 0.25)
+	if len(report.Workers) != 4 {
+		t.Fatalf("analyzeImbalance() returned %d workers, want 4", len(report.Workers))
+	}
+	for _, worker := range report.Workers {
+		if wantOutlier := worker.WorkerID == "w3"; worker.Outlier != wantOutlier {
+			t.Errorf("analyzeImbalance() worker %s outlier = %v, want %v", worker.WorkerID, worker.Outlier, wantOutlier)
+		}
+	}
+	// The mean is 875 operations - w3 is 375 below that
+	if got := report.Workers[3].Operations; math.Abs(got-(-375.0/875)) > 1e-9 {
+		t.Errorf("analyzeImbalance() deviation of w3 = %v, want %v", got, -375.0/875)
+	}
+	if report.FairnessIndex >= 1 || report.FairnessIndex < 0.9 {
+		t.Errorf("analyzeImbalance() fairness index = %v, want slightly below 1", report.FairnessIndex)
+	}
+
+	if report := analyzeImbalance(results, 1); report.Workers[3].Outlier {
+		t.Errorf("analyzeImbalance() flagged w3 with a threshold of 100%%")
+	}
+}
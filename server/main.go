@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/csv"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
 	"net"
 	"os"
+	"os/signal"
+	"sort"
+	"syscall"
 	"time"
 
 	"github.com/mulbc/gosbench/common"
@@ -26,11 +30,56 @@ func init() {
 	flag.IntVar(&serverPort, "p", 2000, "Port on which the server will be available for clients. Default: 2000")
 	flag.BoolVar(&debug, "d", false, "enable debug log output")
 	flag.BoolVar(&trace, "t", false, "enable trace log output")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate for the worker connections - enables TLS")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS key belonging to -tls-cert")
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", "CA to verify worker certificates against - workers without a valid certificate are rejected")
+	flag.StringVar(&token, "token", common.TokenFromEnv(), "Shared secret workers need to present when connecting. Default: $GOSBENCH_TOKEN")
+	flag.DurationVar(&progressInterval, "progress", 5*time.Second, "Interval in which workers report their progress during a test. 0 disables the live progress")
+	flag.Float64Var(&outlierThreshold, "outlier-threshold", 0.25, "Relative deviation from the mean of all workers (0.25 = 25%) above which a worker is reported as outlier")
+	flag.StringVar(&baselineFile, "baseline", "", "Results of an earlier run (JSON or CSV) to compare every test against")
+	flag.Float64Var(&tolerance, "tolerance", 0.05, "Relative change (0.05 = 5%) up to which a metric that got worse than the baseline is no regression")
+	flag.StringVar(&onWorkerFailure, "on-worker-failure", failureContinue, "What to do when a test fails on a worker: 'continue' the test with the remaining workers or 'abort' it and skip all remaining tests")
+	flag.StringVar(&reportFile, "o", fmt.Sprintf("gosbench_results_%s.json", time.Now().Format("20060102-150405")), "File to write the JSON results including the timelines of all tests to")
+}
+
+var configFileLocation string
+var serverPort int
+var tlsCert, tlsKey, tlsClientCA, token string
+var progressInterval time.Duration
+var reportFile string
+var onWorkerFailure string
+var outlierThreshold float64
+var baselineFile string
+var tolerance float64
+var baseline map[string]common.BenchmarkResult
+var readyWorkers *workerPool
+var debug, trace bool
+
+// scheduleDelay is the time between scheduling the start of a test and
+// the start itself - the start message needs to reach all workers in time
+const scheduleDelay = 2 * time.Second
+
+// Values of -on-worker-failure
+const (
+	failureContinue = "continue"
+	failureAbort    = "abort"
+)
+
+// reconnectGracePeriod is the time the server waits for workers to
+// reconnect after the last test, so that they can be shut down
+const reconnectGracePeriod = 15 * time.Second
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		os.Exit(runCompare(os.Args[2:]))
+	}
 	flag.Parse()
-	// Only demand this flag if we are not running go test
-	if configFileLocation == "" && flag.Lookup("test.v") == nil {
+	if configFileLocation == "" {
 		log.Fatal("-c is a mandatory parameter - please specify the config file")
 	}
+	if onWorkerFailure != failureContinue && onWorkerFailure != failureAbort {
+		log.Fatalf("-on-worker-failure must be %q or %q", failureContinue, failureAbort)
+	}
 	if debug {
 		log.SetLevel(log.DebugLevel)
 	} else if trace {
@@ -38,19 +87,18 @@ func init() {
 	} else {
 		log.SetLevel(log.InfoLevel)
 	}
-}
-
-var configFileLocation string
-var serverPort int
-var readyWorkers chan *net.Conn
-var debug, trace bool
 
-func main() {
 	config := common.LoadConfigFromFile(configFileLocation)
 	common.CheckConfig(config)
+	if baselineFile != "" {
+		var err error
+		baseline, _, err = loadResults(baselineFile)
+		if err != nil {
+			log.WithError(err).WithField("file", baselineFile).Fatal("Could not load the baseline")
+		}
+	}
 
-	readyWorkers = make(chan *net.Conn)
-	defer close(readyWorkers)
+	readyWorkers = newWorkerPool()
 
 	// Listen on TCP port 2000 on all available unicast and
 	// anycast IP addresses of the local system.
@@ -59,143 +107,572 @@ func main() {
 		log.WithError(err).Fatal("Could not open port!")
 	}
 	defer l.Close()
+	if tlsCert != "" {
+		tlsConfig, err := common.ServerTLSConfig(tlsCert, tlsKey, tlsClientCA)
+		if err != nil {
+			log.WithError(err).Fatal("Could not set up TLS")
+		}
+		l = tls.NewListener(l, tlsConfig)
+		log.WithField("client verification", tlsClientCA != "").Info("Using TLS for worker connections")
+	} else if tlsClientCA != "" {
+		log.Fatal("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+	if token == "" {
+		log.Warning("No token set - any host that can reach this port can register as worker and receive the S3 credentials")
+	}
 	log.Info("Ready to accept connections")
-	go scheduleTests(config)
+	go acceptWorkers(l)
+
+	// The first SIGINT/SIGTERM aborts the running test - a second one
+	// exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	passed, reportErr := scheduleTests(ctx, config)
+
+	// Workers reconnect right after sending their results - also after an abort
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), reconnectGracePeriod)
+	shutdownWorkers(shutdownCtx)
+	cancel()
+	l.Close()
+	if reportErr != nil {
+		log.WithError(reportErr).WithField("file", reportFile).Error("The JSON results could not be written - exiting with status 1")
+		os.Exit(1)
+	}
+	log.WithField("file", reportFile).Info("Results written")
+	if !passed {
+		log.Error("Not all tests passed - exiting with status 1")
+		os.Exit(1)
+	}
+}
+
+// acceptWorkers registers all workers that connect to the listener
+func acceptWorkers(l net.Listener) {
 	for {
 		// Wait for a connection.
 		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
 			log.WithError(err).Fatal("Issue when waiting for connection of clients")
 		}
 		// Handle the connection in a new goroutine.
 		// The loop then returns to accepting, so that
 		// multiple connections may be served concurrently.
-		go func(c *net.Conn) {
-			log.Infof("%s connected to us ", (*c).RemoteAddr())
-			decoder := json.NewDecoder(*c)
-			var message string
-			err := decoder.Decode(&message)
+		go func(c net.Conn) {
+			log.Infof("%s connected to us ", c.RemoteAddr())
+			connection := common.NewConnection(c)
+			hello, err := connection.ServerHandshake(token)
 			if err != nil {
-				log.WithField("message", message).WithError(err).Error("Could not decode message, closing connection")
-				(*c).Close()
+				log.WithField("worker", c.RemoteAddr()).WithError(err).Error("Handshake with worker failed, closing connection")
+				connection.Close()
 				return
 			}
-			if message == "ready for work" {
-				log.Debug("We have a new worker!")
-				readyWorkers <- c
-				return
-			}
-		}(&conn)
+			log.WithField("labels", common.FormatLabels(hello.Labels)).
+				WithField("capabilities", connection.Capabilities).
+				Debug("We have a new worker!")
+			readyWorkers.add(&readyWorker{conn: connection, labels: hello.Labels, id: hello.InstanceID})
+		}(conn)
 		// Shut down the connection.
 		// defer conn.Close()
 	}
 }
 
-func scheduleTests(config *common.Testconf) {
+// scheduleTests runs all tests of the config one after another and
+// returns whether all of them passed their assertions and the baseline
+// comparison. When the context is canceled, the running test is aborted.
+// The error is set if the JSON report could not be written after the last test
+func scheduleTests(ctx context.Context, config *common.Testconf) (bool, error) {
+	report := &runReport{Start: time.Now().UTC()}
+	failedTests := 0
+	var reportErr error
 
 	for testNumber, test := range config.Tests {
+		run := runTest(ctx, config, testNumber, test)
+		testResult := evaluateTest(test, run)
+		if !testResult.Passed {
+			failedTests++
+		}
+		report.Tests = append(report.Tests, testResult)
+		report.Aborted = run.aborted
+		// Every write contains all tests so far, so only the last one counts
+		reportErr = writeReport(reportFile, report)
+		if reportErr != nil {
+			log.WithError(reportErr).WithField("file", reportFile).Error("Could not write the JSON results")
+		}
+		if run.aborted {
+			log.WithField("test", test.Name).Error("Aborted the performance test - skipping all remaining tests")
+			return false, reportErr
+		}
+	}
+	log.WithField("failed tests", failedTests).Info("All performance tests finished")
+	return failedTests == 0, reportErr
+}
 
-		doneChannel := make(chan bool, test.Workers)
-		resultChannel := make(chan common.BenchmarkResult, test.Workers)
-		continueWorkers := make(chan bool, test.Workers)
-		defer close(doneChannel)
-		defer close(continueWorkers)
-
-		for worker := 0; worker < test.Workers; worker++ {
-			workerConfig := &common.WorkerConf{
-				Test:     test,
-				S3Config: config.S3Config[worker%len(config.S3Config)],
-				WorkerID: fmt.Sprintf("w%d", worker),
-			}
-			workerConnection := <-readyWorkers
-			log.WithField("Worker", (*workerConnection).RemoteAddr()).Infof("We found worker %d / %d for test %d", worker+1, test.Workers, testNumber)
-			go executeTestOnWorker(workerConnection, workerConfig, doneChannel, continueWorkers, resultChannel)
+// testRun contains the raw results of all workers of a test
+type testRun struct {
+	start time.Time
+	stop  time.Time
+	// window is the common measurement window of all workers - zero if
+	// the test ended after a number of operations
+	window  time.Duration
+	results []common.BenchmarkResult
+	// failures contains the workers that did not deliver results
+	failures []*common.Failure
+	// aborted is set when the test was aborted by a signal or a failed
+	// worker - the results only contain what the workers measured until then
+	aborted bool
+}
+
+// workerOutcome is the end of a test on one worker - either its results
+// or the reason why it failed
+type workerOutcome struct {
+	result  *common.BenchmarkResult
+	failure *common.Failure
+}
+
+// runTest hands the test to its workers and waits for their results.
+// If the context is canceled or a worker fails while abortOnFailure is set,
+// the workers are told to abort the test and the partial results they
+// report are returned
+func runTest(ctx context.Context, config *common.Testconf, testNumber int, test *common.TestCaseConfiguration) *testRun {
+	run := &testRun{start: time.Now().UTC()}
+	s3ConfigUsage := map[*common.S3Configuration]int{}
+	testCtx, abortTest := context.WithCancel(ctx)
+	defer abortTest()
+
+	preparedChannel := make(chan bool, test.Workers)
+	outcomeChannel := make(chan workerOutcome, test.Workers)
+	continueWorkers := make(chan common.Schedule, test.Workers)
+	progress := newProgressTracker(test.Name, test.Workers, os.Stdout)
+	progress.cleanup = test.Mode == common.ModeCleanup
+	// activeWorkers are the workers that are expected to report progress
+	activeWorkers := test.Workers
+	collect := func(outcome workerOutcome) {
+		if outcome.result != nil {
+			run.results = append(run.results, *outcome.result)
+			return
+		}
+		run.failures = append(run.failures, outcome.failure)
+		activeWorkers--
+		progress.setWorkers(activeWorkers)
+		log.WithField("test", test.Name).
+			WithField("worker", outcome.failure.WorkerID).
+			WithField("phase", outcome.failure.Phase).
+			Errorf("Test failed on worker: %s", outcome.failure.Error)
+		if onWorkerFailure == failureAbort && testCtx.Err() == nil {
+			log.WithField("test", test.Name).Error("Aborting the test because a worker failed")
+			abortTest()
 		}
-		for worker := 0; worker < test.Workers; worker++ {
-			// Will halt until all workers are done with preparations
-			<-doneChannel
+	}
+
+	startedWorkers := 0
+	for worker := 0; worker < test.Workers; worker++ {
+		// Only take workers that match the test and for which at least one S3 config is suitable
+		readyWorker := readyWorkers.take(testCtx, func(labels map[string]string) bool {
+			return common.MatchLabels(test.WorkerSelector, labels) && len(s3ConfigsForLabels(config.S3Config, labels)) > 0
+		})
+		if readyWorker == nil {
+			break
 		}
+		workerConfig := &common.WorkerConf{
+			Test:             test,
+			S3Config:         leastUsedS3Config(s3ConfigsForLabels(config.S3Config, readyWorker.labels), s3ConfigUsage),
+			WorkerID:         fmt.Sprintf("w%d", worker),
+			WorkerIndex:      worker,
+			ProgressInterval: progressInterval,
+		}
+		log.WithField("Worker", readyWorker.conn.RemoteAddr()).
+			WithField("labels", common.FormatLabels(readyWorker.labels)).
+			WithField("endpoints", workerConfig.S3Config.EndpointList()).
+			Infof("We found worker %d / %d for test %d", worker+1, test.Workers, testNumber)
+		go executeTestOnWorker(testCtx, readyWorker.conn, workerConfig, preparedChannel, continueWorkers, outcomeChannel, progress)
+		startedWorkers++
+	}
+	activeWorkers = startedWorkers
+	progress.setWorkers(activeWorkers)
+	// Workers that fail are not waited for any longer
+	remainingWorkers := startedWorkers
+	for prepared := 0; prepared < remainingWorkers && testCtx.Err() == nil; {
+		// Will halt until all workers are done with preparations
+		select {
+		case <-preparedChannel:
+			prepared++
+		case outcome := <-outcomeChannel:
+			remainingWorkers--
+			collect(outcome)
+		case <-testCtx.Done():
+		}
+	}
+	if testCtx.Err() == nil {
 		// Add sleep after prep phase so that drives can relax
-		time.Sleep(5 * time.Second)
-		log.WithField("test", test.Name).Info("All workers have finished preparations - starting performance test")
-		startTime := time.Now().UTC()
-		for worker := 0; worker < test.Workers; worker++ {
-			continueWorkers <- true
+		select {
+		case <-time.After(5 * time.Second):
+		case <-testCtx.Done():
 		}
-		var benchResults []common.BenchmarkResult
-		for worker := 0; worker < test.Workers; worker++ {
-			// Will halt until all workers are done with their work
-			<-doneChannel
-			benchResults = append(benchResults, <-resultChannel)
+	}
+	var schedule common.Schedule
+	switch {
+	case testCtx.Err() != nil:
+		log.WithField("test", test.Name).Warning("Aborting the test before it started - waiting for the workers to clean up")
+	case remainingWorkers == 0:
+		log.WithField("test", test.Name).Error("The test failed on all workers - skipping it")
+	default:
+		// All workers start at the same time, no matter when they receive the start message
+		schedule.StartAt = time.Now().UTC().Add(scheduleDelay)
+		if test.Runtime != 0 {
+			schedule.StopAt = schedule.StartAt.Add(time.Duration(test.Warmup + test.Runtime + test.Cooldown))
+			// Tests with a runtime share the scheduled measurement window
+			run.window = time.Duration(test.Runtime)
+		}
+		log.WithField("test", test.Name).WithField("start", schedule.StartAt).Info("All workers have finished preparations - starting performance test")
+		run.start = schedule.StartAt
+		// Surplus schedules of failed workers stay in the buffer
+		for worker := 0; worker < startedWorkers; worker++ {
+			continueWorkers <- schedule
 		}
+	}
+	abortLogged := false
+	for ; remainingWorkers > 0; remainingWorkers-- {
+		// Will halt until all workers are done with their work or failed
+		select {
+		case outcome := <-outcomeChannel:
+			collect(outcome)
+			continue
+		case <-testCtx.Done():
+		}
+		if !abortLogged {
+			log.WithField("test", test.Name).Warning("Aborting the test - waiting for the workers to clean up and report their results. Press Ctrl-C again to exit immediately")
+			abortLogged = true
+		}
+		collect(<-outcomeChannel)
+	}
+	run.stop = time.Now().UTC()
+	run.aborted = testCtx.Err() != nil
+	if run.aborted {
+		// The measurements end at the abort, not at the scheduled end
+		run.window = 0
+		log.WithField("test", test.Name).Info("All workers have reported their results after the abort")
+	} else {
 		log.WithField("test", test.Name).Info("All workers have finished the performance test - continuing with next test")
-		stopTime := time.Now().UTC()
-		log.WithField("test", test.Name).Infof("GRAFANA: ?from=%d&to=%d", startTime.UnixNano()/int64(1000000), stopTime.UnixNano()/int64(1000000))
-		benchResult := sumBenchmarkResults(benchResults)
-		benchResult.Duration = stopTime.Sub(startTime)
+		if !schedule.StopAt.IsZero() {
+			// The workers report their results only after their cleanup
+			run.stop = schedule.StopAt
+		}
+	}
+	progress.finish()
+	return run
+}
+
+// evaluateTest aggregates the results of all workers of a test, logs them
+// and checks them against the assertions and the baseline
+func evaluateTest(test *common.TestCaseConfiguration, run *testRun) *testReport {
+	log.WithField("test", test.Name).Infof("GRAFANA: ?from=%d&to=%d", run.start.UnixNano()/int64(1000000), run.stop.UnixNano()/int64(1000000))
+	// Without a common window, the slowest worker determines the window
+	benchResult := sumBenchmarkResults(run.results, run.window)
+	benchResult.Encryption = test.Encryption.Mode
+	if !test.RunsWorkload() {
+		return evaluateDataTest(test, run, benchResult)
+	}
+	timeline, measured := applyTimeline(&benchResult, test, run.results)
+	workerResults := make([]common.BenchmarkResult, 0, len(run.results))
+	for _, result := range run.results {
+		// The cluster wide timeline is part of the report already
+		result.Timeline = nil
+		workerResults = append(workerResults, result)
+	}
+	sort.Slice(workerResults, func(i, j int) bool {
+		return workerResults[i].WorkerID < workerResults[j].WorkerID
+	})
+	imbalance := analyzeImbalance(workerResults, outlierThreshold)
+	benchResult.FairnessIndex = imbalance.FairnessIndex
+	for i, result := range workerResults {
+		deviation := imbalance.Workers[i]
+		entry := log.WithField("test", test.Name).
+			WithField("worker", result.WorkerID).
+			WithField("Operations", result.Operations).
+			WithField("Bytes", result.Bytes).
+			WithField("BW in Byte/s", result.Bandwidth).
+			WithField("Average latency in ms", result.LatencyAvg).
+			WithField("Duration", result.Duration).
+			WithField("Ops deviation", fmt.Sprintf("%+.1f%%", deviation.Operations*100)).
+			WithField("BW deviation", fmt.Sprintf("%+.1f%%", deviation.Bandwidth*100)).
+			WithField("Latency deviation", fmt.Sprintf("%+.1f%%", deviation.Latency*100))
+		if deviation.Outlier {
+			entry.Warningf("WORKER RESULTS - worker deviates more than %.0f%% from the mean of all workers", outlierThreshold*100)
+		} else {
+			entry.Info("WORKER RESULTS")
+		}
+	}
+	log.WithField("test", test.Name).
+		WithField("Total Operations", benchResult.Operations).
+		WithField("Total Bytes", benchResult.Bytes).
+		WithField("Average BW in Byte/s", benchResult.Bandwidth).
+		WithField("Average latency in ms", benchResult.LatencyAvg).
+		WithField("P50 latency in ms", benchResult.LatencyP50).
+		WithField("P90 latency in ms", benchResult.LatencyP90).
+		WithField("P99 latency in ms", benchResult.LatencyP99).
+		WithField("Fairness index", benchResult.FairnessIndex).
+		WithField("Measurement window", benchResult.Duration).
+		WithField("Encryption", benchResult.Encryption).
+		WithField("Aborted", run.aborted).
+		Infof("PERF RESULTS")
+	listing := listingResults(measured)
+	for _, result := range listing {
 		log.WithField("test", test.Name).
-			WithField("Total Operations", benchResult.Operations).
-			WithField("Total Bytes", benchResult.Bytes).
-			WithField("Average BW in Byte/s", benchResult.Bandwidth).
-			WithField("Average latency in ms", benchResult.LatencyAvg).
-			WithField("Test runtime on server", benchResult.Duration).
-			Infof("PERF RESULTS")
-		writeResultToCSV(benchResult)
-	}
-	log.Info("All performance tests finished")
-	for {
-		workerConnection := <-readyWorkers
-		shutdownWorker(workerConnection)
+			WithField("method", result.Method).
+			WithField("Keys", result.Keys).
+			WithField("Pages", result.Pages).
+			WithField("Keys/s", result.KeysPerSecond).
+			WithField("Pages/s", result.PagesPerSecond).
+			Info("LIST RESULTS")
+	}
+	logDataResults(test, "PREP RESULTS", benchResult.Preparation)
+	testResult := &testReport{
+		Name:         test.Name,
+		Start:        run.start,
+		Stop:         run.stop,
+		Warmup:       time.Duration(test.Warmup),
+		Cooldown:     time.Duration(test.Cooldown),
+		ExcludeStart: time.Duration(test.Timeline.ExcludeStart),
+		ExcludeEnd:   time.Duration(test.Timeline.ExcludeEnd),
+		Summary:      benchResult,
+		Workers:      workerResults,
+		Imbalance:    imbalance,
+		Timeline:     timeline,
+		Failures:     run.failures,
+		Aborted:      run.aborted,
+		Listing:      listing,
 	}
+	if run.aborted {
+		// Partial results are neither comparable nor part of the CSV
+		if baseline != nil {
+			log.WithField("test", test.Name).Warning("Test was aborted - its results are not compared to the baseline")
+		}
+		return testResult
+	}
+	writeResultToCSV(benchResult)
+	assertions := evaluateAssertions(test.Assert, benchResult, measured)
+	passed := assertionsPassed(assertions)
+	for _, assertion := range assertions {
+		if assertion.Passed {
+			log.WithField("test", test.Name).Info(assertion)
+		} else {
+			log.WithField("test", test.Name).Error(assertion)
+		}
+	}
+	var comparison *testComparison
+	if baselineResult, ok := baseline[test.Name]; ok {
+		comparison = compareResults(baselineResult, benchResult, tolerance)
+		logComparison(comparison)
+		if comparison.Regressions() > 0 {
+			passed = false
+		}
+	} else if baseline != nil {
+		log.WithField("test", test.Name).Warning("Test is not part of the baseline")
+	}
+	if len(run.failures) > 0 {
+		log.WithField("test", test.Name).Errorf("FAILED: %d of %d workers did not deliver results", len(run.failures), test.Workers)
+		passed = false
+	}
+	testResult.Assertions = assertions
+	testResult.Comparison = comparison
+	testResult.Passed = passed
+	return testResult
 }
 
-func executeTestOnWorker(conn *net.Conn, config *common.WorkerConf, doneChannel chan bool, continueWorkers chan bool, resultChannel chan common.BenchmarkResult) {
-	encoder := json.NewEncoder(*conn)
-	decoder := json.NewDecoder(*conn)
-	_ = encoder.Encode(common.WorkerMessage{Message: "init", Config: config})
+// evaluateDataTest evaluates tests that only prepare or clean up objects.
+// They have no measured phase, so there is nothing to assert or compare
+func evaluateDataTest(test *common.TestCaseConfiguration, run *testRun, benchResult common.BenchmarkResult) *testReport {
+	if test.Mode == common.ModeCleanup {
+		logDataResults(test, "CLEANUP RESULTS", benchResult.Cleanup)
+	} else {
+		logDataResults(test, "PREP RESULTS", benchResult.Preparation)
+	}
+	workerResults := make([]common.BenchmarkResult, 0, len(run.results))
+	workerResults = append(workerResults, run.results...)
+	sort.Slice(workerResults, func(i, j int) bool {
+		return workerResults[i].WorkerID < workerResults[j].WorkerID
+	})
+	if len(run.failures) > 0 {
+		log.WithField("test", test.Name).Errorf("FAILED: %d of %d workers did not deliver results", len(run.failures), test.Workers)
+	}
+	return &testReport{
+		Name:     test.Name,
+		Start:    run.start,
+		Stop:     run.stop,
+		Summary:  benchResult,
+		Workers:  workerResults,
+		Failures: run.failures,
+		Passed:   len(run.failures) == 0 && !run.aborted,
+		Aborted:  run.aborted,
+	}
+}
+
+// logDataResults logs the summary of uploaded or deleted objects
+func logDataResults(test *common.TestCaseConfiguration, message string, stats *common.PrepStats) {
+	if stats == nil {
+		return
+	}
+	log.WithField("test", test.Name).
+		WithField("Objects", stats.Objects).
+		WithField("Errors", stats.Errors).
+		WithField("Bytes", stats.Bytes).
+		WithField("Duration", stats.Duration).
+		WithField("BW in Byte/s", stats.Bandwidth()).
+		Info(message)
+}
+
+// executeTestOnWorker runs the test on one worker. It reports the end of
+// the preparations on preparedChannel and then waits for the schedule on
+// continueWorkers. Exactly one outcome is sent to outcomeChannel - a failure
+// if the worker failed or was dropped. When the context is canceled, the
+// worker is told to abort the test
+func executeTestOnWorker(ctx context.Context, conn *common.Connection, config *common.WorkerConf, preparedChannel chan<- bool, continueWorkers <-chan common.Schedule, outcomeChannel chan<- workerOutcome, progress *progressTracker) {
+	var outcome workerOutcome
+	defer func() {
+		outcomeChannel <- outcome
+	}()
+	defer conn.Close()
+	_ = conn.Send(common.WorkerMessage{Kind: common.MessageInit, Config: config})
 
-	var response common.WorkerMessage
 	for {
-		err := decoder.Decode(&response)
+		response, err := conn.Expect(common.MessagePrepProgress, common.MessagePreparationsDone, common.MessagePing, common.MessageProgress, common.MessageWorkDone, common.MessageFailure)
 		if err != nil {
 			log.WithField("worker", config.WorkerID).WithField("message", response).WithError(err).Error("Worker responded unusually - dropping")
-			(*conn).Close()
+			outcome.failure = &common.Failure{WorkerID: config.WorkerID, Phase: common.PhaseConnection, Error: err.Error()}
 			return
 		}
 		log.Tracef("Response: %+v", response)
-		switch response.Message {
-		case "preparations done":
-			doneChannel <- true
-			<-continueWorkers
-			_ = encoder.Encode(common.WorkerMessage{Message: "start work"})
-		case "work done":
-			doneChannel <- true
-			resultChannel <- response.BenchResult
-			(*conn).Close()
+		switch response.Kind {
+		case common.MessagePing:
+			_ = conn.Pong()
+		case common.MessagePrepProgress:
+			if response.PrepStats != nil {
+				progress.addPreparation(config.WorkerID, response.PrepStats)
+			}
+		case common.MessagePreparationsDone:
+			if response.Clock != nil && conn.HasCapability(common.CapabilityClockSync) {
+				log.WithField("worker", config.WorkerID).
+					WithField("offset", response.Clock.Offset).
+					WithField("round trip", response.Clock.RoundTrip).
+					Info("Estimated clock offset of worker")
+			}
+			preparedChannel <- true
+			select {
+			case schedule := <-continueWorkers:
+				message := common.WorkerMessage{Kind: common.MessageStartWork}
+				if conn.HasCapability(common.CapabilityClockSync) {
+					message.Schedule = &schedule
+				}
+				_ = conn.Send(message)
+				// The worker listens for an abort until it sent its results
+				stopAbort := context.AfterFunc(ctx, func() { abortWorker(conn, config.WorkerID) })
+				defer stopAbort()
+			case <-ctx.Done():
+				abortWorker(conn, config.WorkerID)
+			}
+		case common.MessageProgress:
+			progress.add(response.Progress)
+		case common.MessageWorkDone:
+			outcome.result = &response.BenchResult
+			return
+		case common.MessageFailure:
+			outcome.failure = response.Failure
+			if outcome.failure == nil {
+				outcome.failure = &common.Failure{Error: "worker reported a failure without details"}
+			}
+			// The worker ID is ours to assign
+			outcome.failure.WorkerID = config.WorkerID
 			return
 		}
 	}
 }
 
-func shutdownWorker(conn *net.Conn) {
-	encoder := json.NewEncoder(*conn)
-	log.WithField("Worker", (*conn).RemoteAddr()).Info("Shutting down worker")
-	_ = encoder.Encode(common.WorkerMessage{Message: "shutdown"})
+// abortWorker tells the worker to abort its test. Workers that do not
+// support aborts are disconnected instead - their results are lost
+func abortWorker(conn *common.Connection, workerID string) {
+	if !conn.HasCapability(common.CapabilityAbort) {
+		log.WithField("worker", workerID).Warning("Worker does not support aborting a test - disconnecting it")
+		conn.Close()
+		return
+	}
+	log.WithField("worker", workerID).Info("Aborting the test on worker")
+	if err := conn.Send(common.WorkerMessage{Kind: common.MessageAbort}); err != nil {
+		log.WithField("worker", workerID).WithError(err).Warning("Could not send the abort to the worker")
+	}
 }
 
-func sumBenchmarkResults(results []common.BenchmarkResult) common.BenchmarkResult {
+// shutdownWorkers shuts down every worker that ever connected to us.
+// Busy workers are waited for until the context is done
+func shutdownWorkers(ctx context.Context) {
+	pending := readyWorkers.knownWorkers()
+	for {
+		waitCtx := ctx
+		if len(pending) == 0 {
+			// Only shut down the workers that are waiting already
+			waitCtx = canceledContext
+		}
+		readyWorker := readyWorkers.take(waitCtx, func(map[string]string) bool { return true })
+		if readyWorker == nil {
+			break
+		}
+		delete(pending, readyWorker.id)
+		shutdownWorker(readyWorker.conn)
+	}
+	for _, name := range pending {
+		log.WithField("worker", name).Warning("Worker did not come back in time to be shut down")
+	}
+}
+
+func shutdownWorker(conn *common.Connection) {
+	log.WithField("Worker", conn.RemoteAddr()).Info("Shutting down worker")
+	_ = conn.Send(common.WorkerMessage{Kind: common.MessageShutdown})
+}
+
+// sumBenchmarkResults aggregates the results of all workers of a test.
+// The average latency is weighted by the operations of each worker and the
+// bandwidth is calculated over the common measurement window. Without a
+// window, the duration of the slowest worker is used
+func sumBenchmarkResults(results []common.BenchmarkResult, window time.Duration) common.BenchmarkResult {
 	sum := common.BenchmarkResult{}
-	bandwidthAverages := float64(0)
-	latencyAverages := float64(0)
+	if len(results) == 0 {
+		return sum
+	}
+	weightedLatency := float64(0)
 	for _, result := range results {
 		sum.Bytes += result.Bytes
 		sum.Operations += result.Operations
-		latencyAverages += result.LatencyAvg
-		bandwidthAverages += result.Bandwidth
+		weightedLatency += result.LatencyAvg * result.Operations
+		if result.Preparation != nil {
+			if sum.Preparation == nil {
+				sum.Preparation = &common.PrepStats{}
+			}
+			sum.Preparation.Merge(result.Preparation)
+		}
+		if result.Cleanup != nil {
+			if sum.Cleanup == nil {
+				sum.Cleanup = &common.PrepStats{}
+			}
+			sum.Cleanup.Merge(result.Cleanup)
+		}
+		if window == 0 && result.Duration > sum.Duration {
+			sum.Duration = result.Duration
+		}
+	}
+	if window != 0 {
+		sum.Duration = window
+	}
+	if sum.Operations > 0 {
+		sum.LatencyAvg = weightedLatency / sum.Operations
+	}
+	if sum.Duration > 0 {
+		sum.Bandwidth = sum.Bytes / sum.Duration.Seconds()
 	}
-	sum.LatencyAvg = latencyAverages / float64(len(results))
 	sum.TestName = results[0].TestName
-	sum.Bandwidth = bandwidthAverages
 	return sum
 }
 
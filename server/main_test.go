@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_sumBenchmarkResults(t *testing.T) {
+	tests := []struct {
+		name          string
+		results       []common.BenchmarkResult
+		window        time.Duration
+		wantOps       float64
+		wantBytes     float64
+		wantBandwidth float64
+		wantLatency   float64
+		wantDuration  time.Duration
+	}{
+		{"No results", nil, 0, 0, 0, 0, 0, 0},
+		{"Latency is weighted by operations",
+			[]common.BenchmarkResult{
+				{TestName: "test", Operations: 10, Bytes: 100, LatencyAvg: 100, Duration: 10 * time.Second},
+				{TestName: "test", Operations: 990, Bytes: 9900, LatencyAvg: 1, Duration: 10 * time.Second},
+			}, 10 * time.Second, 1000, 10000, 1000, 1.99, 10 * time.Second},
+		{"Bandwidth over the common window",
+			[]common.BenchmarkResult{
+				// A worker that measured a shorter time must not inflate the bandwidth
+				{TestName: "test", Operations: 100, Bytes: 1000, LatencyAvg: 1, Duration: 5 * time.Second},
+				{TestName: "test", Operations: 100, Bytes: 1000, LatencyAvg: 1, Duration: 10 * time.Second},
+			}, 10 * time.Second, 200, 2000, 200, 1, 10 * time.Second},
+		{"Slowest worker determines the window",
+			[]common.BenchmarkResult{
+				{TestName: "test", Operations: 100, Bytes: 1000, LatencyAvg: 2, Duration: 5 * time.Second},
+				{TestName: "test", Operations: 100, Bytes: 1000, LatencyAvg: 4, Duration: 20 * time.Second},
+			}, 0, 200, 2000, 100, 3, 20 * time.Second},
+		{"Worker without operations",
+			[]common.BenchmarkResult{
+				{TestName: "test", Duration: 10 * time.Second},
+			}, 0, 0, 0, 0, 0, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sumBenchmarkResults(tt.results, tt.window)
+			if got.Operations != tt.wantOps || got.Bytes != tt.wantBytes || got.Duration != tt.wantDuration {
+				t.Errorf("sumBenchmarkResults() = ops %v bytes %v duration %v, want ops %v bytes %v duration %v",
+					got.Operations, got.Bytes, got.Duration, tt.wantOps, tt.wantBytes, tt.wantDuration)
+			}
+			if got.Bandwidth != tt.wantBandwidth {
+				t.Errorf("sumBenchmarkResults() bandwidth = %v, want %v", got.Bandwidth, tt.wantBandwidth)
+			}
+			if math.Abs(got.LatencyAvg-tt.wantLatency) > 1e-9 {
+				t.Errorf("sumBenchmarkResults() latency = %v, want %v", got.LatencyAvg, tt.wantLatency)
+			}
+		})
+	}
+}
+
+func Test_executeTestOnWorker(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities []string
+		// worker plays the worker side after it received the config
+		worker      func(worker *common.Connection)
+		wantAborted bool
+		wantFailure string
+	}{
+		{
+			name:         "worker supports aborts",
+			capabilities: []string{common.CapabilityAbort},
+			worker: func(worker *common.Connection) {
+				_ = worker.Send(common.WorkerMessage{Kind: common.MessagePreparationsDone})
+				if _, err := worker.Expect(common.MessageAbort); err == nil {
+					_ = worker.Send(common.WorkerMessage{Kind: common.MessageWorkDone, BenchResult: common.BenchmarkResult{Aborted: true}})
+				}
+			},
+			wantAborted: true,
+		},
+		{
+			name: "worker without abort support is dropped",
+			worker: func(worker *common.Connection) {
+				_ = worker.Send(common.WorkerMessage{Kind: common.MessagePreparationsDone})
+				_, _ = worker.Receive()
+			},
+			wantAborted: true,
+			wantFailure: common.PhaseConnection,
+		},
+		{
+			name:         "worker reports a failed preparation",
+			capabilities: []string{common.CapabilityFailure},
+			worker: func(worker *common.Connection) {
+				_ = worker.Send(common.WorkerMessage{Kind: common.MessageFailure, Failure: &common.Failure{Phase: common.PhasePreparation, Error: "bucket not found"}})
+			},
+			wantFailure: common.PhasePreparation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverSide, workerSide := net.Pipe()
+			server, worker := common.NewConnection(serverSide), common.NewConnection(workerSide)
+			server.Capabilities = tt.capabilities
+			defer worker.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			prepared := make(chan bool, 1)
+			outcomes := make(chan workerOutcome, 1)
+			go executeTestOnWorker(ctx, server, &common.WorkerConf{WorkerID: "w0"}, prepared, make(chan common.Schedule), outcomes, newProgressTracker("test", 1, io.Discard))
+			go func() {
+				if _, err := worker.Expect(common.MessageInit); err == nil {
+					tt.worker(worker)
+				}
+			}()
+			if tt.wantAborted {
+				<-prepared
+				cancel()
+			}
+
+			select {
+			case outcome := <-outcomes:
+				if tt.wantFailure != "" {
+					if outcome.failure == nil || outcome.failure.Phase != tt.wantFailure || outcome.failure.WorkerID != "w0" {
+						t.Fatalf("executeTestOnWorker() failure = %+v, want a failure of w0 in phase %s", outcome.failure, tt.wantFailure)
+					}
+					return
+				}
+				if outcome.result == nil || outcome.result.Aborted != tt.wantAborted {
+					t.Errorf("executeTestOnWorker() result = %+v, want aborted: %v", outcome.result, tt.wantAborted)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("executeTestOnWorker() did not report an outcome")
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// progressTracker merges the interval stats that the workers stream
+// during a test and prints a live progress table
+type progressTracker struct {
+	mu        sync.Mutex
+	testName  string
+	workers   int
+	intervals map[int]*common.IntervalStats
+	reported  map[int]int
+	// nextPrint is the index of the first interval that was not printed yet
+	nextPrint     int
+	headerPrinted bool
+	start         time.Time
+	// preparations contains the latest preparation progress per worker
+	preparations map[string]common.PrepStats
+	prepUpdates  int
+	// cleanup is set for tests with mode cleanup - their workers report the
+	// deleted objects as preparation progress, without known totals
+	cleanup bool
+	out     io.Writer
+}
+
+func newProgressTracker(testName string, workers int, out io.Writer) *progressTracker {
+	return &progressTracker{
+		testName:     testName,
+		workers:      workers,
+		intervals:    map[int]*common.IntervalStats{},
+		reported:     map[int]int{},
+		preparations: map[string]common.PrepStats{},
+		out:          out,
+	}
+}
+
+// add merges the intervals one worker reported. All intervals that are
+// now reported by all workers are printed as one row per method
+func (p *progressTracker) add(intervals []*common.IntervalStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, stats := range intervals {
+		interval, ok := p.intervals[stats.Index]
+		if !ok {
+			interval = &common.IntervalStats{Index: stats.Index}
+			p.intervals[stats.Index] = interval
+		}
+		interval.Merge(stats)
+		if p.start.IsZero() || interval.Start.Before(p.start) {
+			p.start = interval.Start
+		}
+		p.reported[stats.Index]++
+	}
+	p.printComplete()
+}
+
+// setWorkers changes the number of workers that report intervals - when
+// fewer workers started than the test asked for or a worker failed.
+// Intervals that all remaining workers reported are printed right away
+func (p *progressTracker) setWorkers(workers int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.workers = workers
+	p.printComplete()
+}
+
+// printComplete prints all intervals that are reported by all workers
+func (p *progressTracker) printComplete() {
+	var complete []*common.IntervalStats
+	for index := p.nextPrint; p.intervals[index] != nil && p.reported[index] >= p.workers; index++ {
+		complete = append(complete, p.intervals[index])
+	}
+	p.print(complete)
+}
+
+// addPreparation stores the preparation progress of one worker. The
+// progress of all workers is printed once every preparing worker sent an
+// update - roughly once per progress interval
+func (p *progressTracker) addPreparation(workerID string, stats *common.PrepStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.preparations[workerID] = *stats
+	p.prepUpdates++
+	preparing := 0
+	for _, prep := range p.preparations {
+		if p.cleanup || prep.Objects+prep.Errors < prep.TotalObjects {
+			preparing++
+		}
+	}
+	if p.prepUpdates < preparing {
+		return
+	}
+	p.prepUpdates = 0
+
+	var sum common.PrepStats
+	for _, prep := range p.preparations {
+		sum.Merge(&prep)
+	}
+	if p.cleanup {
+		fmt.Fprintf(p.out, "Cleaning up test %s: %d objects deleted, %.1f MiB, %.2f MiB/s, %d errors\n",
+			p.testName,
+			sum.Objects,
+			float64(sum.Bytes)/common.MEGABYTE,
+			sum.Bandwidth()/common.MEGABYTE,
+			sum.Errors,
+		)
+		return
+	}
+	percent := float64(100)
+	if sum.TotalObjects > 0 {
+		percent = float64(sum.Objects+sum.Errors) / float64(sum.TotalObjects) * 100
+	}
+	fmt.Fprintf(p.out, "Preparing test %s: %d/%d objects (%.1f%%), %.1f/%.1f MiB, %.2f MiB/s, %d errors, ETA %s\n",
+		p.testName,
+		sum.Objects+sum.Errors,
+		sum.TotalObjects,
+		percent,
+		float64(sum.Bytes)/common.MEGABYTE,
+		float64(sum.TotalBytes)/common.MEGABYTE,
+		sum.Bandwidth()/common.MEGABYTE,
+		sum.Errors,
+		sum.Remaining().Round(time.Second),
+	)
+}
+
+// finish prints all intervals that were not reported by all workers,
+// e.g. because some workers finished earlier than others
+func (p *progressTracker) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var remaining []*common.IntervalStats
+	for index := p.nextPrint; p.intervals[index] != nil; index++ {
+		remaining = append(remaining, p.intervals[index])
+	}
+	p.print(remaining)
+}
+
+func (p *progressTracker) print(intervals []*common.IntervalStats) {
+	if len(intervals) == 0 {
+		return
+	}
+	p.nextPrint = intervals[len(intervals)-1].Index + 1
+	if !p.headerPrinted {
+		fmt.Fprintf(p.out, "Progress of test %s\n", p.testName)
+		fmt.Fprintf(p.out, "%8s  %-10s %10s %10s %8s %9s %9s %9s %9s\n", "TIME", "METHOD", "OPS/s", "MiB/s", "ERRORS", "AVG ms", "P50 ms", "P90 ms", "P99 ms")
+		p.headerPrinted = true
+	}
+
+	sum := common.SumIntervals(intervals)
+	elapsed := sum.Start.Add(sum.Duration).Sub(p.start).Round(time.Second)
+	for _, method := range sum.MethodNames() {
+		printProgressRow(p.out, elapsed, method, sum.Methods[method], sum.Duration)
+	}
+	if len(sum.Methods) > 1 {
+		total := sum.Total()
+		printProgressRow(p.out, elapsed, "TOTAL", &total, sum.Duration)
+	}
+}
+
+func printProgressRow(out io.Writer, elapsed time.Duration, method string, stats *common.MethodStats, duration time.Duration) {
+	seconds := duration.Seconds()
+	if seconds <= 0 {
+		seconds = 1
+	}
+	fmt.Fprintf(out, "%8s  %-10s %10.1f %10.2f %8d %9.2f %9.2f %9.2f %9.2f\n",
+		elapsed,
+		method,
+		float64(stats.Operations)/seconds,
+		float64(stats.Bytes)/seconds/common.MEGABYTE,
+		stats.Errors,
+		stats.Latency.Mean(),
+		stats.Latency.Quantile(0.5),
+		stats.Latency.Quantile(0.9),
+		stats.Latency.Quantile(0.99),
+	)
+}
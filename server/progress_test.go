@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func TestProgressTracker(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := &bytes.Buffer{}
+	progress := newProgressTracker("test", 2, out)
+
+	progress.add(workerTimeline(start, 1, 10, 10))
+	if out.Len() != 0 {
+		t.Fatalf("add() printed before all workers reported:\n%s", out)
+	}
+	progress.add(workerTimeline(start, 1, 10, 10, 10))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	// Title, header and one row for the two intervals both workers reported
+	if len(lines) != 3 {
+		t.Fatalf("add() printed %d lines, want 3:\n%s", len(lines), out)
+	}
+	if fields := strings.Fields(lines[2]); fields[0] != "2s" || fields[1] != "GET" || fields[2] != "20.0" {
+		t.Errorf("add() printed row %q, want 2s GET with 20 ops/s", lines[2])
+	}
+
+	out.Reset()
+	progress.finish()
+	if fields := strings.Fields(out.String()); len(fields) < 3 || fields[0] != "3s" || fields[2] != "10.0" {
+		t.Errorf("finish() printed %q, want the remaining interval with 10 ops/s", out)
+	}
+}
+
+func TestProgressTracker_setWorkers(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := &bytes.Buffer{}
+	progress := newProgressTracker("test", 3, out)
+
+	// Only two of three workers started
+	progress.setWorkers(2)
+	if out.Len() != 0 {
+		t.Fatalf("setWorkers() printed without any reported interval:\n%s", out)
+	}
+	progress.add(workerTimeline(start, 1, 10, 10))
+	progress.add(workerTimeline(start, 1, 10))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(strings.TrimSpace(lines[2]), "1s") {
+		t.Fatalf("add() printed %d lines, want the header and the first interval:\n%s", len(lines), out)
+	}
+
+	// The second worker fails - the first one keeps the progress going
+	out.Reset()
+	progress.setWorkers(1)
+	if fields := strings.Fields(out.String()); len(fields) < 3 || fields[0] != "2s" || fields[2] != "10.0" {
+		t.Fatalf("setWorkers() printed %q, want the second interval with 10 ops/s", out)
+	}
+	out.Reset()
+	progress.add([]*common.IntervalStats{workerTimeline(start, 1, 10, 10, 10)[2]})
+	if fields := strings.Fields(out.String()); len(fields) < 3 || fields[0] != "3s" {
+		t.Errorf("add() printed %q after a worker failed, want the third interval", out)
+	}
+}
+
+func TestProgressTracker_addPreparation(t *testing.T) {
+	out := &bytes.Buffer{}
+	progress := newProgressTracker("test", 2, out)
+
+	progress.addPreparation("w0", &common.PrepStats{Objects: 1, TotalObjects: 4, Bytes: common.MEGABYTE, TotalBytes: 4 * common.MEGABYTE, Duration: time.Second})
+	if out.Len() == 0 {
+		t.Fatal("addPreparation() did not print the progress of the only preparing worker")
+	}
+	out.Reset()
+	progress.addPreparation("w1", &common.PrepStats{Objects: 1, TotalObjects: 4, Bytes: common.MEGABYTE, TotalBytes: 4 * common.MEGABYTE, Duration: time.Second})
+	if out.Len() != 0 {
+		t.Fatalf("addPreparation() printed before all preparing workers sent an update:\n%s", out)
+	}
+	progress.addPreparation("w0", &common.PrepStats{Objects: 4, TotalObjects: 4, Bytes: 4 * common.MEGABYTE, TotalBytes: 4 * common.MEGABYTE, Duration: 2 * time.Second})
+	want := "Preparing test test: 5/8 objects (62.5%), 5.0/8.0 MiB, 2.50 MiB/s, 0 errors, ETA 1s"
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("addPreparation() printed %q, want %q", got, want)
+	}
+}
+
+func TestProgressTracker_addPreparationCleanup(t *testing.T) {
+	out := &bytes.Buffer{}
+	progress := newProgressTracker("test", 2, out)
+	progress.cleanup = true
+
+	progress.addPreparation("w0", &common.PrepStats{Objects: 2, Bytes: common.MEGABYTE, Duration: time.Second})
+	if out.Len() == 0 {
+		t.Fatal("addPreparation() did not print the progress of the only cleaning worker")
+	}
+	out.Reset()
+	progress.addPreparation("w1", &common.PrepStats{Objects: 1, Bytes: common.MEGABYTE, Duration: time.Second})
+	if out.Len() != 0 {
+		t.Fatalf("addPreparation() printed before all cleaning workers sent an update:\n%s", out)
+	}
+	progress.addPreparation("w0", &common.PrepStats{Objects: 4, Errors: 1, Bytes: 3 * common.MEGABYTE, Duration: 2 * time.Second})
+	want := "Cleaning up test test: 5 objects deleted, 4.0 MiB, 2.00 MiB/s, 1 errors"
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("addPreparation() printed %q, want %q", got, want)
+	}
+}
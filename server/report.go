@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// runReport contains the results of all tests of one gosbench run
+type runReport struct {
+	Start time.Time     `json:"start"`
+	Tests []*testReport `json:"tests"`
+	// Aborted is set when the run was interrupted by a signal
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// testReport contains the summary and the cluster wide timeline of one test
+type testReport struct {
+	Name         string                 `json:"name"`
+	Start        time.Time              `json:"start"`
+	Stop         time.Time              `json:"stop"`
+	Warmup       time.Duration          `json:"warmup"`
+	Cooldown     time.Duration          `json:"cooldown"`
+	ExcludeStart time.Duration          `json:"exclude_start"`
+	ExcludeEnd   time.Duration          `json:"exclude_end"`
+	Summary      common.BenchmarkResult `json:"summary"`
+	// Workers contains the results of the single workers without their timelines
+	Workers   []common.BenchmarkResult `json:"workers"`
+	Imbalance imbalanceReport          `json:"imbalance"`
+	// Assertions is empty when the test has no assert block
+	Assertions []assertionResult `json:"assertions,omitempty"`
+	// Comparison is only set when the run is compared to a baseline
+	Comparison *testComparison `json:"comparison,omitempty"`
+	// Failures lists the workers that failed and did not deliver results
+	Failures []*common.Failure `json:"failures,omitempty"`
+	// Passed is false when an assertion failed, a regression was found or
+	// a worker failed
+	Passed bool `json:"passed"`
+	// Aborted is set when the test was interrupted - it has no results then
+	Aborted bool `json:"aborted,omitempty"`
+	// Listing contains the throughput of the list methods in the measured window
+	Listing  []listingResult         `json:"listing,omitempty"`
+	Timeline []*common.IntervalStats `json:"timeline"`
+}
+
+// listingResult contains how many keys and pages a list method returned
+type listingResult struct {
+	Method         string  `json:"method"`
+	Keys           uint64  `json:"keys"`
+	Pages          uint64  `json:"pages"`
+	KeysPerSecond  float64 `json:"keys_per_second"`
+	PagesPerSecond float64 `json:"pages_per_second"`
+}
+
+// applyTimeline merges the timelines of all workers into the summary of
+// the test. If the test has a warm-up or cool-down or excludes a window at
+// the start or end of the timeline, the summary is calculated from the
+// remaining intervals only. It returns the merged timeline and the sum of
+// the intervals the summary is based on
+func applyTimeline(summary *common.BenchmarkResult, test *common.TestCaseConfiguration, results []common.BenchmarkResult) ([]*common.IntervalStats, common.IntervalStats) {
+	timelines := make([][]*common.IntervalStats, 0, len(results))
+	for _, result := range results {
+		timelines = append(timelines, result.Timeline)
+	}
+	timeline := common.MergeTimelines(timelines...)
+	summary.Timeline = nil
+	if len(timeline) == 0 {
+		return timeline, common.IntervalStats{}
+	}
+
+	excludeStart := time.Duration(test.Warmup + test.Timeline.ExcludeStart)
+	excludeEnd := time.Duration(test.Cooldown + test.Timeline.ExcludeEnd)
+	window := timeline
+	if excludeStart > 0 || excludeEnd > 0 {
+		window = common.TimelineWindow(timeline, excludeStart, excludeEnd)
+	}
+	sum := common.SumIntervals(window)
+	total := sum.Total()
+	if len(window) != len(timeline) && sum.Duration > 0 {
+		summary.Operations = float64(total.Operations)
+		summary.Bytes = float64(total.Bytes)
+		summary.Duration = sum.Duration
+		summary.Bandwidth = summary.Bytes / sum.Duration.Seconds()
+	}
+	if total.Latency.Count > 0 {
+		// The merged histograms are more precise than the averages of the workers
+		summary.LatencyAvg = total.Latency.Mean()
+	}
+	summary.LatencyP50 = total.Latency.Quantile(0.5)
+	summary.LatencyP90 = total.Latency.Quantile(0.9)
+	summary.LatencyP99 = total.Latency.Quantile(0.99)
+	return timeline, sum
+}
+
+// listingResults returns the listed keys and pages per second of all
+// methods that listed pages in the given window, sorted by method
+func listingResults(window common.IntervalStats) []listingResult {
+	var results []listingResult
+	for method, stats := range window.Methods {
+		if stats.Pages == 0 {
+			continue
+		}
+		result := listingResult{Method: method, Keys: stats.Keys, Pages: stats.Pages}
+		if window.Duration > 0 {
+			result.KeysPerSecond = float64(stats.Keys) / window.Duration.Seconds()
+			result.PagesPerSecond = float64(stats.Pages) / window.Duration.Seconds()
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Method < results[j].Method
+	})
+	return results
+}
+
+// writeReport (re)writes the JSON report containing all finished tests
+func writeReport(path string, report *runReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
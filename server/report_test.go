@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// workerTimeline returns a timeline of one second intervals with a
+// constant latency and the given operations per interval
+func workerTimeline(start time.Time, latency float64, ops ...uint64) []*common.IntervalStats {
+	timeline := make([]*common.IntervalStats, 0, len(ops))
+	for index, count := range ops {
+		stats := &common.MethodStats{Operations: count, Bytes: count * 10}
+		for i := uint64(0); i < count; i++ {
+			stats.Latency.Observe(latency)
+		}
+		timeline = append(timeline, &common.IntervalStats{
+			Index:    index,
+			Start:    start.Add(time.Duration(index) * time.Second),
+			Duration: time.Second,
+			Methods:  map[string]*common.MethodStats{"GET": stats},
+		})
+	}
+	return timeline
+}
+
+func Test_applyTimeline(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []common.BenchmarkResult{
+		{Operations: 40, Bytes: 400, LatencyAvg: 1, Timeline: workerTimeline(start, 1, 10, 10, 10, 10)},
+		{Operations: 4, Bytes: 40, LatencyAvg: 100, Timeline: workerTimeline(start, 100, 1, 1, 1, 1)},
+	}
+	tests := []struct {
+		name          string
+		exclude       time.Duration
+		warmup        time.Duration
+		wantOps       float64
+		wantBandwidth float64
+	}{
+		{"Whole timeline", 0, 0, 44, 10},
+		{"Excluded start", time.Second, 0, 33, 110},
+		{"Warm-up", 0, 2 * time.Second, 22, 110},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := &common.TestCaseConfiguration{Warmup: common.Duration(tt.warmup)}
+			test.Timeline.ExcludeStart = common.Duration(tt.exclude)
+			summary := sumBenchmarkResults(results, 4*time.Second)
+			summary.Bandwidth = 10
+			timeline, window := applyTimeline(&summary, test, results)
+			if len(timeline) != 4 {
+				t.Fatalf("applyTimeline() returned %d intervals, want 4", len(timeline))
+			}
+			if total := window.Total(); float64(total.Operations) != tt.wantOps {
+				t.Errorf("applyTimeline() window contains %d operations, want %v", total.Operations, tt.wantOps)
+			}
+			if summary.Operations != tt.wantOps || summary.Bandwidth != tt.wantBandwidth {
+				t.Errorf("applyTimeline() ops %v bandwidth %v, want ops %v bandwidth %v", summary.Operations, summary.Bandwidth, tt.wantOps, tt.wantBandwidth)
+			}
+			// 10 of 11 operations per interval took 1ms, 1 took 100ms
+			if want := 10.0/11*1 + 1.0/11*100; math.Abs(summary.LatencyAvg-want) > 1e-9 {
+				t.Errorf("applyTimeline() latency = %v, want %v", summary.LatencyAvg, want)
+			}
+			if summary.LatencyP50 > 2 || summary.LatencyP99 < 100 {
+				t.Errorf("applyTimeline() p50 %v p99 %v, want about 1 and 100", summary.LatencyP50, summary.LatencyP99)
+			}
+		})
+	}
+}
+
+func Test_listingResults(t *testing.T) {
+	window := common.IntervalStats{
+		Duration: 2 * time.Second,
+		Methods: map[string]*common.MethodStats{
+			"GET":      {Operations: 10},
+			"LIST":     {Operations: 4, Keys: 4000, Pages: 4},
+			"LIST_VER": {Operations: 2, Keys: 10, Pages: 2},
+		},
+	}
+	got := listingResults(window)
+	want := []listingResult{
+		{Method: "LIST", Keys: 4000, Pages: 4, KeysPerSecond: 2000, PagesPerSecond: 2},
+		{Method: "LIST_VER", Keys: 10, Pages: 2, KeysPerSecond: 5, PagesPerSecond: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listingResults() = %v, want %v", got, want)
+	}
+	if got := listingResults(common.IntervalStats{}); got != nil {
+		t.Errorf("listingResults() of an empty window = %v, want nil", got)
+	}
+}
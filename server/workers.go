@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// readyWorker is a connected worker that waits for work
+type readyWorker struct {
+	conn   *common.Connection
+	labels map[string]string
+	// id identifies the worker process across reconnects
+	id string
+}
+
+// workerPool holds all workers that are ready for work. In contrast to
+// a plain channel, workers can be taken out by their labels
+type workerPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	workers []*readyWorker
+	// known maps the IDs of all workers that ever connected to their names
+	known map[string]string
+}
+
+func newWorkerPool() *workerPool {
+	pool := &workerPool{known: map[string]string{}}
+	pool.cond = sync.NewCond(&pool.mu)
+	return pool
+}
+
+// add puts a worker into the pool
+func (p *workerPool) add(worker *readyWorker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.workers = append(p.workers, worker)
+	p.known[worker.id] = workerName(worker.labels, worker.id)
+	p.cond.Broadcast()
+}
+
+// take blocks until a worker is available that matches the given
+// filter and removes it from the pool. It returns nil once the context is done
+func (p *workerPool) take(ctx context.Context, matches func(labels map[string]string) bool) *readyWorker {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.cond.Broadcast()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	warned := false
+	for {
+		for i, worker := range p.workers {
+			if matches(worker.labels) {
+				p.workers = append(p.workers[:i], p.workers[i+1:]...)
+				return worker
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if len(p.workers) > 0 && !warned {
+			log.Warningf("%d workers are waiting but none of them matches the selectors of the next test", len(p.workers))
+			warned = true
+		}
+		p.cond.Wait()
+	}
+}
+
+// knownWorkers returns the IDs and names of all workers that were ever
+// added to the pool
+func (p *workerPool) knownWorkers() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	known := make(map[string]string, len(p.known))
+	for id, name := range p.known {
+		known[id] = name
+	}
+	return known
+}
+
+// workerName is the name of a worker for log messages
+func workerName(labels map[string]string, id string) string {
+	if hostname := labels["hostname"]; hostname != "" && hostname != id {
+		return fmt.Sprintf("%s (%s)", hostname, id)
+	}
+	return id
+}
+
+// canceledContext lets take return immediately if no worker is waiting
+var canceledContext = func() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}()
+
+// s3ConfigsForLabels returns all S3 configs whose worker selector
+// matches the given worker labels
+func s3ConfigsForLabels(s3Configs []*common.S3Configuration, labels map[string]string) []*common.S3Configuration {
+	var matching []*common.S3Configuration
+	for _, s3Config := range s3Configs {
+		if common.MatchLabels(s3Config.WorkerSelector, labels) {
+			matching = append(matching, s3Config)
+		}
+	}
+	return matching
+}
+
+// leastUsedS3Config picks the matching S3 config that got assigned to
+// the fewest workers so far. Ties are broken by the order in the config file
+func leastUsedS3Config(s3Configs []*common.S3Configuration, usage map[*common.S3Configuration]int) *common.S3Configuration {
+	var chosen *common.S3Configuration
+	for _, s3Config := range s3Configs {
+		if chosen == nil || usage[s3Config] < usage[chosen] {
+			chosen = s3Config
+		}
+	}
+	usage[chosen]++
+	return chosen
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_leastUsedS3Config(t *testing.T) {
+	eu := &common.S3Configuration{Endpoint: "http://eu:80", WorkerSelector: map[string]string{"zone": "eu"}}
+	us := &common.S3Configuration{Endpoint: "http://us:80", WorkerSelector: map[string]string{"zone": "us"}}
+	any1 := &common.S3Configuration{Endpoint: "http://any1:80"}
+	any2 := &common.S3Configuration{Endpoint: "http://any2:80"}
+	s3Configs := []*common.S3Configuration{eu, us, any1, any2}
+
+	usage := map[*common.S3Configuration]int{}
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   *common.S3Configuration
+	}{
+		{"First eu worker", map[string]string{"zone": "eu"}, eu},
+		{"Second eu worker goes to unused config", map[string]string{"zone": "eu"}, any1},
+		{"Worker without zone", nil, any2},
+		{"us worker", map[string]string{"zone": "us"}, us},
+		{"Ties are broken by config order", map[string]string{"zone": "eu"}, eu},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := leastUsedS3Config(s3ConfigsForLabels(s3Configs, tt.labels), usage); got != tt.want {
+				t.Errorf("leastUsedS3Config() = %s, want %s", got.Endpoint, tt.want.Endpoint)
+			}
+		})
+	}
+}
+
+func TestWorkerPool_take(t *testing.T) {
+	pool := newWorkerPool()
+	pool.add(&readyWorker{labels: map[string]string{"zone": "eu"}})
+
+	taken := make(chan *readyWorker)
+	go func() {
+		taken <- pool.take(context.Background(), func(labels map[string]string) bool {
+			return common.MatchLabels(map[string]string{"zone": "us"}, labels)
+		})
+	}()
+	select {
+	case <-taken:
+		t.Fatal("take() returned a worker that does not match")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	us := &readyWorker{labels: map[string]string{"zone": "us"}}
+	pool.add(us)
+	select {
+	case worker := <-taken:
+		if worker != us {
+			t.Errorf("take() = %v, want the us worker", worker.labels)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("take() did not return the matching worker")
+	}
+	if len(pool.workers) != 1 {
+		t.Errorf("pool contains %d workers, want 1", len(pool.workers))
+	}
+}
+
+func TestWorkerPool_takeCanceled(t *testing.T) {
+	pool := newWorkerPool()
+	all := func(map[string]string) bool { return true }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if worker := pool.take(ctx, all); worker != nil {
+		t.Errorf("take() on an empty pool = %v, want nil", worker)
+	}
+	worker := &readyWorker{labels: map[string]string{"hostname": "w1"}, id: "a1"}
+	time.AfterFunc(10*time.Millisecond, func() { pool.add(worker) })
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if got := pool.take(ctx, all); got != worker {
+		t.Errorf("take() = %v, want the worker added while waiting", got)
+	}
+	// Waiting workers are still handed out with a canceled context
+	pool.add(worker)
+	if got := pool.take(canceledContext, all); got != worker {
+		t.Errorf("take() with a canceled context = %v, want the waiting worker", got)
+	}
+	// A second worker process on the same host is known separately
+	pool.add(&readyWorker{labels: map[string]string{"hostname": "w1"}, id: "b2"})
+	want := map[string]string{"a1": "w1 (a1)", "b2": "w1 (b2)"}
+	if known := pool.knownWorkers(); !reflect.DeepEqual(known, want) {
+		t.Errorf("knownWorkers() = %v, want %v", known, want)
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// cleanupBatchSize is the maximum number of objects S3 deletes with one request
+const cleanupBatchSize = 1000
+
+// cleanupTest deletes the objects of the test from the buckets this worker
+// is responsible for. Buckets that are empty afterwards are removed as well.
+// If reportProgress is set, it is called every progressInterval and at the
+// end with the deletions so far
+func cleanupTest(testConfig *common.TestCaseConfiguration, workerIndex int, abort <-chan struct{}, reportProgress func(common.PrepStats), progressInterval time.Duration) (common.PrepStats, error) {
+	buckets, err := cleanupBuckets(testConfig, workerIndex)
+	if err != nil {
+		return common.PrepStats{}, err
+	}
+	objectPrefix := testConfig.ObjectPrefix
+	if dataset := testConfig.DatasetConfig; dataset != nil {
+		objectPrefix = dataset.ObjectPrefix
+	}
+	match := common.ObjectPrefixMatcher(objectPrefix)
+	if testConfig.KeyTemplate.Template != "" {
+		// Templated names do not need to start with the object prefix, so
+		// only names the template generates - and their copies - match
+		pattern := testConfig.KeyTemplate.Pattern(testConfig.ObjectPrefix)
+		match = func(key string) bool {
+			return pattern.MatchString(strings.TrimSuffix(key, "-copy"))
+		}
+	}
+
+	progress := &cleanupProgress{start: time.Now()}
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		if reportProgress == nil || progressInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reportProgress(progress.current())
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stopProgress)
+		<-progressDone
+		if reportProgress != nil {
+			reportProgress(progress.current())
+		}
+	}()
+
+	for _, bucket := range buckets {
+		select {
+		case <-abort:
+			log.Warning("Cleanup was aborted")
+			return progress.current(), nil
+		default:
+		}
+		deleted, err := deleteMatchingObjects(bucket, match, prepareClients(testConfig), abort, progress)
+		if err != nil {
+			log.WithError(err).WithField("bucket", bucket).Error("Error when cleaning up bucket - continuing with the next bucket")
+			continue
+		}
+		if err := abortMultipartUploads(bucket, match); err != nil {
+			log.WithError(err).WithField("bucket", bucket).Error("Error when cleaning up bucket - continuing with the next bucket")
+			continue
+		}
+		// Buckets that still contain other objects are kept
+		_, err = housekeepingSvc.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			log.WithError(err).WithField("bucket", bucket).Debug("Keeping bucket")
+		}
+		log.WithField("bucket", bucket).Infof("Deleted %d objects, %d errors", deleted.Objects, deleted.Errors)
+	}
+	return progress.current(), nil
+}
+
+// cleanupProgress sums up the deletions in all buckets of a cleanup,
+// including the bucket that is currently cleaned up
+type cleanupProgress struct {
+	mu       sync.Mutex
+	start    time.Time
+	finished common.PrepStats
+	deleter  *batchDeleter
+}
+
+// current returns the deletions so far
+func (p *cleanupProgress) current() common.PrepStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.finished
+	if p.deleter != nil {
+		deleted := p.deleter.progress()
+		stats.Merge(&deleted)
+	}
+	stats.Duration = time.Since(p.start)
+	return stats
+}
+
+// setDeleter sets the deleter of the bucket that is cleaned up now
+func (p *cleanupProgress) setDeleter(deleter *batchDeleter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deleter = deleter
+}
+
+// bucketDone adds the deletions of a finished bucket
+func (p *cleanupProgress) bucketDone(deleted common.PrepStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished.Merge(&deleted)
+	p.deleter = nil
+}
+
+// cleanupBuckets returns the buckets of the test that this worker cleans
+// up. The buckets are dealt to the workers of the test in turns
+func cleanupBuckets(testConfig *common.TestCaseConfiguration, workerIndex int) ([]string, error) {
+	var buckets []string
+	if dataset := testConfig.DatasetConfig; dataset != nil {
+		for bucket := uint64(0); bucket < dataset.Buckets; bucket++ {
+			buckets = append(buckets, dataset.BucketName(bucket))
+		}
+	} else {
+		existing, err := listBuckets(housekeepingSvc)
+		if err != nil {
+			return nil, fmt.Errorf("Could not list the buckets to clean up: %w", err)
+		}
+		matchesBucket := common.BucketNameMatcher(testConfig.BucketPrefix)
+		for _, bucket := range existing {
+			if matchesBucket(bucket) {
+				buckets = append(buckets, bucket)
+			}
+		}
+		// All workers need to agree on the order of the buckets
+		sort.Strings(buckets)
+	}
+	workers := max(testConfig.Workers, 1)
+	var own []string
+	for i, bucket := range buckets {
+		if i%workers == workerIndex {
+			own = append(own, bucket)
+		}
+	}
+	return own, nil
+}
+
+// deleteBucket deletes all objects, versions and incomplete multipart
+// uploads of the bucket and then the bucket itself
+func deleteBucket(bucket string, clients int) error {
+	stats, err := deleteMatchingObjects(bucket, matchAll, clients, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := abortMultipartUploads(bucket, matchAll); err != nil {
+		return err
+	}
+	log.WithField("bucket", bucket).Infof("Deleted %d objects, %d errors", stats.Objects, stats.Errors)
+	_, err = housekeepingSvc.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+	return err
+}
+
+func matchAll(string) bool {
+	return true
+}
+
+// deleteMatchingObjects deletes all objects of the bucket for which match
+// returns true - in versioned buckets including all versions and delete
+// markers. The bucket is listed page by page while the listed objects are
+// deleted in parallel batches. If progress is set, the deletions are added
+// to it
+func deleteMatchingObjects(bucket string, match func(key string) bool, clients int, abort <-chan struct{}, progress *cleanupProgress) (common.PrepStats, error) {
+	versioned, err := bucketVersioned(bucket)
+	if err != nil {
+		log.WithError(err).WithField("bucket", bucket).Warning("Could not get the versioning of the bucket - deleting the current objects only")
+	}
+	deleter := newBatchDeleter(bucket, clients)
+	if progress != nil {
+		progress.setDeleter(deleter)
+	}
+	if versioned {
+		err = deleter.addVersions(match, abort)
+	} else {
+		err = deleter.addObjects(match, abort)
+	}
+	stats := deleter.finish()
+	if progress != nil {
+		progress.bucketDone(stats)
+	}
+	return stats, err
+}
+
+// bucketVersioned returns whether versioning was ever enabled on the bucket.
+// Suspending versioning keeps the existing versions
+func bucketVersioned(bucket string) (bool, error) {
+	result, err := housekeepingSvc.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return false, err
+	}
+	return result.Status != "", nil
+}
+
+// abortMultipartUploads aborts all incomplete multipart uploads of the
+// bucket for which match returns true
+func abortMultipartUploads(bucket string, match func(key string) bool) error {
+	p := s3.NewListMultipartUploadsPaginator(housekeepingSvc, &s3.ListMultipartUploadsInput{Bucket: aws.String(bucket)})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("Problems when listing multipart uploads of bucket %s: %w", bucket, err)
+		}
+		for _, upload := range page.Uploads {
+			if !match(aws.ToString(upload.Key)) {
+				continue
+			}
+			_, err := housekeepingSvc.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucket),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			if err != nil {
+				log.WithError(err).WithField("bucket", bucket).WithField("object", aws.ToString(upload.Key)).Error("Could not abort multipart upload")
+			}
+		}
+	}
+	return nil
+}
+
+// cleanupProgressInterval determines how often the progress of deleting
+// the objects of a bucket is logged
+const cleanupProgressInterval = 10 * time.Second
+
+// batchDeleter deletes the objects that are added to it in batches of
+// cleanupBatchSize with parallel requests
+type batchDeleter struct {
+	bucket  string
+	batch   []deletion
+	batches chan []deletion
+	wg      sync.WaitGroup
+	done    chan struct{}
+	start   time.Time
+	mu      sync.Mutex
+	stats   common.PrepStats
+}
+
+// deletion is a single object or version to delete
+type deletion struct {
+	object types.ObjectIdentifier
+	size   int64
+}
+
+// id identifies the object in the errors of a batch delete
+func (d deletion) id() [2]string {
+	return [2]string{aws.ToString(d.object.Key), aws.ToString(d.object.VersionId)}
+}
+
+func newBatchDeleter(bucket string, clients int) *batchDeleter {
+	d := &batchDeleter{
+		bucket:  bucket,
+		batches: make(chan []deletion),
+		done:    make(chan struct{}),
+		start:   time.Now(),
+	}
+	d.wg.Add(clients)
+	for client := 0; client < clients; client++ {
+		go func() {
+			defer d.wg.Done()
+			for batch := range d.batches {
+				d.delete(batch)
+			}
+		}()
+	}
+	go d.logProgress()
+	return d
+}
+
+// addObjects adds the current objects of the bucket
+func (d *batchDeleter) addObjects(match func(key string) bool, abort <-chan struct{}) error {
+	// Deleting listed objects does not affect the next pages
+	p := s3.NewListObjectsV2Paginator(housekeepingSvc, &s3.ListObjectsV2Input{Bucket: aws.String(d.bucket)})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("Problems when listing contents of bucket %s: %w", d.bucket, err)
+		}
+		for _, object := range page.Contents {
+			if !match(aws.ToString(object.Key)) {
+				continue
+			}
+			if !d.add(deletion{object: types.ObjectIdentifier{Key: object.Key}, size: aws.ToInt64(object.Size)}, abort) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// addVersions adds all versions and delete markers of the bucket
+func (d *batchDeleter) addVersions(match func(key string) bool, abort <-chan struct{}) error {
+	p := s3.NewListObjectVersionsPaginator(housekeepingSvc, &s3.ListObjectVersionsInput{Bucket: aws.String(d.bucket)})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("Problems when listing versions of bucket %s: %w", d.bucket, err)
+		}
+		for _, version := range page.Versions {
+			if !match(aws.ToString(version.Key)) {
+				continue
+			}
+			if !d.add(deletion{object: types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId}, size: aws.ToInt64(version.Size)}, abort) {
+				return nil
+			}
+		}
+		for _, marker := range page.DeleteMarkers {
+			if !match(aws.ToString(marker.Key)) {
+				continue
+			}
+			if !d.add(deletion{object: types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId}}, abort) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// add queues an object for deletion. It returns false if the cleanup was
+// aborted while waiting for a free client
+func (d *batchDeleter) add(object deletion, abort <-chan struct{}) bool {
+	d.batch = append(d.batch, object)
+	if len(d.batch) < cleanupBatchSize {
+		return true
+	}
+	batch := d.batch
+	d.batch = nil
+	select {
+	case d.batches <- batch:
+		return true
+	case <-abort:
+		return false
+	}
+}
+
+// finish deletes the remaining objects and waits for all batches
+func (d *batchDeleter) finish() common.PrepStats {
+	if len(d.batch) > 0 {
+		d.batches <- d.batch
+		d.batch = nil
+	}
+	close(d.batches)
+	d.wg.Wait()
+	close(d.done)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.Duration = time.Since(d.start)
+	return d.stats
+}
+
+func (d *batchDeleter) delete(batch []deletion) {
+	identifiers := make([]types.ObjectIdentifier, len(batch))
+	for i, object := range batch {
+		identifiers[i] = object.object
+	}
+	failed := map[[2]string]bool{}
+	errs, err := deleteObjects(housekeepingSvc, d.bucket, identifiers)
+	if err != nil {
+		log.WithError(err).WithField("bucket", d.bucket).Error("Could not delete objects")
+		for _, object := range batch {
+			failed[object.id()] = true
+		}
+	}
+	for _, e := range errs {
+		log.WithField("bucket", d.bucket).WithField("object", aws.ToString(e.Key)).Debugf("Could not delete object: %s", aws.ToString(e.Message))
+		failed[[2]string{aws.ToString(e.Key), aws.ToString(e.VersionId)}] = true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, object := range batch {
+		if failed[object.id()] {
+			d.stats.Errors++
+			continue
+		}
+		d.stats.Objects++
+		d.stats.Bytes += uint64(object.size)
+	}
+}
+
+// progress returns the deletions of the bucket so far
+func (d *batchDeleter) progress() common.PrepStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := d.stats
+	stats.Duration = time.Since(d.start)
+	return stats
+}
+
+func (d *batchDeleter) logProgress() {
+	ticker := time.NewTicker(cleanupProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+		stats := d.progress()
+		elapsed := stats.Duration
+		log.WithField("bucket", d.bucket).Infof("Cleaning up: %d objects deleted (%.1f/s), %.1f MiB, %d errors",
+			stats.Objects, float64(stats.Objects)/elapsed.Seconds(), float64(stats.Bytes)/common.MEGABYTE, stats.Errors)
+	}
+}
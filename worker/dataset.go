@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// fillDatasetWorkqueue fills the work queue with operations on the objects
+// of the dataset that belong to this worker. It returns the uploads of all
+// objects that do not exist yet with the expected size - unless the test
+// has mode run and assumes that all objects exist
+func fillDatasetWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, workerIndex int) ([]WorkItem, error) {
+	addOperationValues(testConfig, Workqueue)
+	dataset := testConfig.DatasetConfig
+
+	for bucket := uint64(0); bucket < dataset.Buckets; bucket++ {
+		bucketName := dataset.BucketName(bucket)
+		err := createBucket(housekeepingSvc, bucketName, testConfig.Versioning == common.VersioningEnabled)
+		if err != nil {
+			log.WithError(err).WithField("bucket", bucketName).Error("Error when creating bucket")
+		}
+	}
+
+	partition := dataset.Partition(workerIndex, testConfig.Workers)
+	existing := map[string]map[string]uint64{}
+	var uploads []WorkItem
+	verify := testConfig.Mode != common.ModeRun
+	for _, object := range partition {
+		objects, ok := existing[object.Bucket]
+		if verify && !ok {
+			listed, err := listObjects(housekeepingSvc, dataset.ObjectPrefix, object.Bucket)
+			if err != nil {
+				return nil, fmt.Errorf("Problems when listing contents of bucket %s: %w", object.Bucket, err)
+			}
+			objects = make(map[string]uint64, len(listed))
+			for _, o := range listed {
+				objects[*o.Key] = uint64(*o.Size)
+			}
+			existing[object.Bucket] = objects
+		}
+		if size, ok := objects[object.Key]; verify && (!ok || size != object.Size) {
+			uploads = append(uploads, &UploadOperation{
+				Bucket:     object.Bucket,
+				ObjectName: object.Key,
+				ObjectSize: object.Size,
+			})
+		}
+		if !testConfig.RunsWorkload() {
+			continue
+		}
+
+		nextOp := GetNextOperation(Workqueue)
+		switch nextOp {
+		case "read":
+			err := IncreaseOperationValue(nextOp, 1/float64(testConfig.ReadWeight), Workqueue)
+			if err != nil {
+				log.WithError(err).Error("Could not increase operational Value - ignoring")
+			}
+			new := &ReadOperation{
+				TestName:                 testConfig.Name,
+				Bucket:                   object.Bucket,
+				ObjectName:               object.Key,
+				ObjectSize:               object.Size,
+				WorksOnPreexistingObject: true,
+			}
+			*Workqueue.Queue = append(*Workqueue.Queue, new)
+		case "write":
+			err := IncreaseOperationValue(nextOp, 1/float64(testConfig.WriteWeight), Workqueue)
+			if err != nil {
+				log.WithError(err).Error("Could not increase operational Value - ignoring")
+			}
+			new := &WriteOperation{
+				TestName:   testConfig.Name,
+				Bucket:     object.Bucket,
+				ObjectName: object.Key,
+				ObjectSize: object.Size,
+			}
+			*Workqueue.Queue = append(*Workqueue.Queue, new)
+		case "list":
+			err := IncreaseOperationValue(nextOp, 1/float64(testConfig.ListWeight), Workqueue)
+			if err != nil {
+				log.WithError(err).Error("Could not increase operational Value - ignoring")
+			}
+			new := &ListOperation{
+				TestName:   testConfig.Name,
+				Bucket:     object.Bucket,
+				ObjectName: object.Key,
+				ObjectSize: object.Size,
+				Prefix:     listPrefix(testConfig, object.Key),
+				MaxKeys:    testConfig.List.MaxKeys,
+				Version:    testConfig.List.Version,
+			}
+			*Workqueue.Queue = append(*Workqueue.Queue, new)
+		case "put_tagging", "get_tagging", "copy", "put_acl", "get_acl", "head":
+			addMetadataOperation(nextOp, testConfig, Workqueue, object.Bucket, object.Key, object.Size, true)
+		case "overwrite":
+			err := IncreaseOperationValue(nextOp, 1/float64(testConfig.OverwriteWeight), Workqueue)
+			if err != nil {
+				log.WithError(err).Error("Could not increase operational Value - ignoring")
+			}
+			new := &OverwriteOperation{
+				TestName:                 testConfig.Name,
+				Bucket:                   object.Bucket,
+				ObjectName:               object.Key,
+				ObjectSize:               object.Size,
+				WorksOnPreexistingObject: true,
+			}
+			*Workqueue.Queue = append(*Workqueue.Queue, new)
+		}
+	}
+	if verify {
+		log.Infof("Dataset %s: %d of %d objects of this worker exist already, uploading %d", dataset.Name, len(partition)-len(uploads), len(partition), len(uploads))
+	}
+	return uploads, nil
+}
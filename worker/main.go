@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,6 +10,7 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -20,6 +21,9 @@ import (
 var config common.WorkerConf
 var prometheusPort int
 var debug, trace bool
+var workerLabels map[string]string
+var tlsConfig *tls.Config
+var token string
 
 func init() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
@@ -30,11 +34,20 @@ func init() {
 }
 
 func main() {
-	var serverAddress string
+	var serverAddress, labels string
+	var useTLS bool
+	var tlsCA, tlsCert, tlsKey, tlsServerName string
 	flag.StringVar(&serverAddress, "s", "", "Gosbench Server IP and Port in the form '192.168.1.1:2000'")
+	flag.StringVar(&labels, "l", "", "Labels of this worker in the form 'rack=r1,zone=eu1' - the hostname label is added automatically")
 	flag.IntVar(&prometheusPort, "p", 8888, "Port on which the Prometheus Exporter will be available. Default: 8888")
 	flag.BoolVar(&debug, "d", false, "enable debug log output")
 	flag.BoolVar(&trace, "t", false, "enable trace log output")
+	flag.BoolVar(&useTLS, "tls", false, "use TLS for the server connection - implied by the other -tls flags")
+	flag.StringVar(&tlsCA, "tls-ca", "", "CA to verify the server certificate against. Default: system roots")
+	flag.StringVar(&tlsCert, "tls-cert", "", "Client certificate to present to the server")
+	flag.StringVar(&tlsKey, "tls-key", "", "Key belonging to -tls-cert")
+	flag.StringVar(&tlsServerName, "tls-server-name", "", "Expected name in the server certificate. Default: host part of -s")
+	flag.StringVar(&token, "token", common.TokenFromEnv(), "Shared secret to present to the server. Default: $GOSBENCH_TOKEN")
 	flag.Parse()
 	if serverAddress == "" {
 		log.Fatal("-s is a mandatory parameter - please specify the server IP and Port")
@@ -48,6 +61,28 @@ func main() {
 		log.SetLevel(log.InfoLevel)
 	}
 
+	var err error
+	workerLabels, err = common.ParseLabels(labels)
+	if err != nil {
+		log.WithError(err).Fatal("Could not parse worker labels")
+	}
+	if _, ok := workerLabels["hostname"]; !ok {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.WithError(err).Warning("Could not determine hostname for worker labels")
+		} else {
+			workerLabels["hostname"] = hostname
+		}
+	}
+	log.WithField("labels", common.FormatLabels(workerLabels)).Info("Worker labels")
+
+	if useTLS || tlsCA != "" || tlsCert != "" || tlsKey != "" || tlsServerName != "" {
+		tlsConfig, err = common.WorkerTLSConfig(tlsCA, tlsCert, tlsKey, tlsServerName)
+		if err != nil {
+			log.WithError(err).Fatal("Could not set up TLS")
+		}
+	}
+
 	for {
 		err := connectToServer(serverAddress)
 		if err != nil {
@@ -58,88 +93,431 @@ func main() {
 }
 
 func connectToServer(serverAddress string) error {
-	conn, err := net.Dial("tcp", serverAddress)
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.Dial("tcp", serverAddress, tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", serverAddress)
+	}
 	if err != nil {
 		// return errors.New("Could not establish connection to server yet")
 		return err
 	}
-	encoder := json.NewEncoder(conn)
-	decoder := json.NewDecoder(conn)
-
-	_ = encoder.Encode("ready for work")
+	connection := common.NewConnection(conn)
+	defer connection.Close()
+	err = connection.WorkerHandshake(workerLabels, token)
+	if err != nil {
+		return fmt.Errorf("Handshake with server failed: %w", err)
+	}
+	log.WithField("capabilities", connection.Capabilities).Debug("Connected to server")
 
-	var response common.WorkerMessage
 	Workqueue := &Workqueue{
 		Queue: &[]WorkItem{},
 	}
+	var clock common.Clock
+	var preparation common.PrepStats
 	for {
-		err := decoder.Decode(&response)
+		response, err := connection.Expect(common.MessageInit, common.MessageStartWork, common.MessageAbort, common.MessageShutdown)
 		if err != nil {
 			log.WithField("message", response).WithError(err).Error("Server responded unusually - reconnecting")
-			conn.Close()
 			return errors.New("Issue when receiving work from server")
 		}
 		log.Tracef("Response: %+v", response)
-		switch response.Message {
-		case "init":
+		switch response.Kind {
+		case common.MessageInit:
 			config = *response.Config
 			log.Info("Got config from server - starting preparations now")
-
-			InitS3(*config.S3Config)
-			fillWorkqueue(config.Test, Workqueue, config.WorkerID, config.Test.WorkerShareBuckets)
-
-			for _, work := range *Workqueue.Queue {
-				err = work.Prepare()
+			preparation, err = prepareTest(Workqueue, prepProgressReporter(connection, &config))
+			if err != nil {
+				return reportFailure(connection, common.PhasePreparation, err)
+			}
+			log.Info("Preparations finished - waiting on server to start work")
+			if connection.HasCapability(common.CapabilityClockSync) {
+				clock, err = connection.SyncClock(common.ClockSyncRounds)
 				if err != nil {
-					log.WithError(err).Error("Error during work preparation - ignoring")
+					return reportFailure(connection, common.PhasePreparation, fmt.Errorf("Clock synchronisation with server failed: %w", err))
 				}
+				log.WithField("offset", clock.Offset).WithField("round trip", clock.RoundTrip).Debug("Estimated clock offset to server")
 			}
-			log.Info("Preparations finished - waiting on server to start work")
-			_ = encoder.Encode(common.WorkerMessage{Message: "preparations done"})
-		case "start work":
-			if config == (common.WorkerConf{}) || len(*Workqueue.Queue) == 0 {
-				log.Fatal("Was instructed to start work - but the preparation step is incomplete - reconnecting")
-				return nil
+			_ = connection.Send(common.WorkerMessage{Kind: common.MessagePreparationsDone, Clock: &clock})
+		case common.MessageStartWork, common.MessageAbort:
+			if config == (common.WorkerConf{}) || (config.Test.RunsWorkload() && len(*Workqueue.Queue) == 0) {
+				return reportFailure(connection, common.PhaseStart, errors.New("Was instructed to start work - but the preparation step is incomplete"))
+			}
+			abort := make(chan struct{})
+			testDone := make(chan struct{})
+			if response.Kind == common.MessageAbort {
+				// The test is aborted before it started - we still clean up and report
+				log.Warning("Server aborted the test before it started")
+				close(abort)
+			} else if connection.HasCapability(common.CapabilityAbort) {
+				// Nothing else is received until the results are sent - the
+				// connection is closed after that, which ends this goroutine
+				go func() {
+					_, err := connection.Expect(common.MessageAbort)
+					select {
+					case <-testDone:
+						return
+					default:
+					}
+					if err != nil {
+						log.WithError(err).Warning("Lost the connection to the server - aborting the test")
+					} else {
+						log.Warning("Server aborted the test")
+					}
+					close(abort)
+				}()
 			}
-			log.Info("Starting to work")
-			duration := PerfTest(config.Test, Workqueue, config.WorkerID)
-			benchResults := getCurrentPromValues(config.Test.Name)
-			benchResults.Duration = duration
-			benchResults.Bandwidth = benchResults.Bytes / duration.Seconds()
-			log.Infof("PROM VALUES %+v", benchResults)
-			_ = encoder.Encode(common.WorkerMessage{Message: "work done", BenchResult: benchResults})
+			var benchResults common.BenchmarkResult
+			switch config.Test.Mode {
+			case common.ModePrepare:
+				log.Info("Test only prepares objects - there is no work to do")
+				close(testDone)
+				benchResults.TestName = config.Test.Name
+			case common.ModeCleanup:
+				log.Info("Starting to clean up")
+				cleanup, err := cleanupTest(config.Test, config.WorkerIndex, abort, prepProgressReporter(connection, &config), config.ProgressInterval)
+				close(testDone)
+				if err != nil {
+					return reportFailure(connection, common.PhaseCleanup, err)
+				}
+				benchResults.TestName = config.Test.Name
+				benchResults.Cleanup = &cleanup
+				select {
+				case <-abort:
+					benchResults.Aborted = true
+				default:
+				}
+			default:
+				log.Info("Starting to work")
+				var reportProgress func([]*common.IntervalStats)
+				if connection.HasCapability(common.CapabilityProgress) && config.ProgressInterval > 0 {
+					reportProgress = func(intervals []*common.IntervalStats) {
+						if len(intervals) == 0 {
+							return
+						}
+						err := connection.Send(common.WorkerMessage{Kind: common.MessageProgress, Progress: intervals})
+						if err != nil {
+							log.WithError(err).Warning("Could not send progress to server")
+						}
+					}
+				}
+				// The schedule is in server time - convert it to our clock
+				var schedule common.Schedule
+				if response.Schedule != nil {
+					schedule.StartAt = response.Schedule.StartAt.Add(-clock.Offset)
+					if !response.Schedule.StopAt.IsZero() {
+						schedule.StopAt = response.Schedule.StopAt.Add(-clock.Offset)
+					}
+				}
+				benchResults = PerfTest(config.Test, Workqueue, config.WorkerID, schedule, abort, reportProgress, config.ProgressInterval)
+				close(testDone)
+				benchResults.Timeline = recorder.timeline()
+			}
+			benchResults.WorkerID = config.WorkerID
+			benchResults.ClockOffset = clock.Offset
+			benchResults.Preparation = &preparation
+			log.WithField("test", benchResults.TestName).
+				WithField("Operations", benchResults.Operations).
+				WithField("Bytes", benchResults.Bytes).
+				WithField("Bandwidth", benchResults.Bandwidth).
+				WithField("LatencyAvg", benchResults.LatencyAvg).
+				WithField("Duration", benchResults.Duration).
+				WithField("Intervals", len(benchResults.Timeline)).
+				WithField("Aborted", benchResults.Aborted).
+				Info("PROM VALUES")
+			_ = connection.Send(common.WorkerMessage{Kind: common.MessageWorkDone, BenchResult: benchResults})
 			// Work is done - return to being a ready worker by reconnecting
 			return nil
-		case "shutdown":
+		case common.MessageShutdown:
 			log.Info("Server told us to shut down - all work is done for today")
 			os.Exit(0)
 		}
 	}
 }
 
+// prepareTest sets up the S3 clients and the work queue for the test in
+// config and prepares all work items. Failing work items are ignored
+func prepareTest(Workqueue *Workqueue, reportProgress func(common.PrepStats)) (common.PrepStats, error) {
+	if err := InitS3(*config.S3Config); err != nil {
+		return common.PrepStats{}, err
+	}
+	objectMetadata = newMetadata(config.Test.Metadata.Count, config.Test.Metadata.Size)
+	encryption, err := newEncryption(config.Test.Encryption)
+	if err != nil {
+		return common.PrepStats{}, err
+	}
+	objectEncryption = encryption
+	if config.Test.KeyTemplate.Template != "" {
+		// The parsed template is not part of the config the server sends
+		if err := config.Test.KeyTemplate.Parse(); err != nil {
+			return common.PrepStats{}, err
+		}
+	}
+	var prepareQueue []WorkItem
+	switch {
+	case config.Test.Mode == common.ModeCleanup:
+		// The objects are deleted once the server starts the work
+		return common.PrepStats{}, nil
+	case config.Test.DatasetConfig != nil:
+		// The objects of a dataset are uploaded by their own work items, as
+		// they are only uploaded if they do not exist yet
+		uploads, err := fillDatasetWorkqueue(config.Test, Workqueue, config.WorkerIndex)
+		if err != nil {
+			return common.PrepStats{}, err
+		}
+		prepareQueue = uploads
+	case config.Test.Mode == common.ModePrepare:
+		prepareQueue = fillPrepareWorkqueue(config.Test, config.WorkerID, config.Test.WorkerShareBuckets)
+	default:
+		if err := fillWorkqueue(config.Test, Workqueue, config.WorkerID, config.Test.WorkerShareBuckets); err != nil {
+			return common.PrepStats{}, err
+		}
+		if config.Test.Mode == common.ModeRun {
+			log.Info("Test runs on existing objects - skipping the upload")
+		} else {
+			prepareQueue = *Workqueue.Queue
+		}
+	}
+	return prepareWorkqueue(config.Test.Name, prepareQueue, prepareClients(config.Test), reportProgress, config.ProgressInterval), nil
+}
+
+// prepareClients returns the number of parallel clients for preparing and
+// cleaning up objects
+func prepareClients(testConfig *common.TestCaseConfiguration) int {
+	if testConfig.PrepareClients > 0 {
+		return testConfig.PrepareClients
+	}
+	return max(testConfig.ParallelClients, 1)
+}
+
+// prepareWorkqueue prepares all work items with the given number of
+// parallel clients. If reportProgress is set, it is called every
+// progressInterval and at the end with the progress so far
+func prepareWorkqueue(testName string, queue []WorkItem, clients int, reportProgress func(common.PrepStats), progressInterval time.Duration) common.PrepStats {
+	if clients < 1 {
+		clients = 1
+	}
+	var total common.PrepStats
+	for _, work := range queue {
+		if size, ok := preparedObject(work); ok {
+			total.TotalObjects++
+			total.TotalBytes += size
+		}
+	}
+	promPrepObjectsTotal.WithLabelValues(testName).Set(float64(total.TotalObjects))
+	promPrepBytesTotal.WithLabelValues(testName).Set(float64(total.TotalBytes))
+
+	var uploaded, failed, uploadedBytes atomic.Uint64
+	start := time.Now()
+	progress := func() common.PrepStats {
+		stats := total
+		stats.Objects, stats.Errors, stats.Bytes = uploaded.Load(), failed.Load(), uploadedBytes.Load()
+		stats.Duration = time.Since(start)
+		promPrepObjects.WithLabelValues(testName).Set(float64(stats.Objects))
+		promPrepBytes.WithLabelValues(testName).Set(float64(stats.Bytes))
+		return stats
+	}
+
+	workChannel := make(chan WorkItem, clients)
+	wg := &sync.WaitGroup{}
+	wg.Add(clients)
+	for client := 0; client < clients; client++ {
+		go func() {
+			defer wg.Done()
+			for work := range workChannel {
+				size, uploads := preparedObject(work)
+				if err := work.Prepare(); err != nil {
+					log.WithError(err).Error("Error during work preparation - ignoring")
+					if uploads {
+						failed.Add(1)
+					}
+					continue
+				}
+				if uploads {
+					uploaded.Add(1)
+					uploadedBytes.Add(size)
+				}
+			}
+		}()
+	}
+	log.WithField("objects", total.TotalObjects).WithField("bytes", total.TotalBytes).Infof("Preparing with %d parallel clients", clients)
+
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		if reportProgress == nil || progressInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reportProgress(progress())
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
+	for _, work := range queue {
+		workChannel <- work
+	}
+	close(workChannel)
+	wg.Wait()
+	close(stopProgress)
+	<-progressDone
+
+	stats := progress()
+	if reportProgress != nil {
+		reportProgress(stats)
+	}
+	log.WithField("objects", stats.Objects).
+		WithField("errors", stats.Errors).
+		WithField("bytes", stats.Bytes).
+		WithField("duration", stats.Duration).
+		WithField("BW in Byte/s", stats.Bandwidth()).
+		Info("Preparation throughput")
+	return stats
+}
+
+// prepProgressReporter returns a function that sends the progress of
+// preparing or cleaning up a test to the server - nil if the server does
+// not want it
+func prepProgressReporter(connection *common.Connection, config *common.WorkerConf) func(common.PrepStats) {
+	if !connection.HasCapability(common.CapabilityPrepProgress) || config.ProgressInterval <= 0 {
+		return nil
+	}
+	return func(stats common.PrepStats) {
+		err := connection.Send(common.WorkerMessage{Kind: common.MessagePrepProgress, PrepStats: &stats})
+		if err != nil {
+			log.WithError(err).Warning("Could not send preparation progress to server")
+		}
+	}
+}
+
+// reportFailure tells the server that the test failed on this worker.
+// The caller returns afterwards, so that we reconnect and are ready for
+// the next test. Servers that do not know failures just lose the connection
+func reportFailure(connection *common.Connection, phase string, err error) error {
+	log.WithError(err).WithField("phase", phase).Error("Test failed on this worker - reconnecting")
+	if !connection.HasCapability(common.CapabilityFailure) {
+		return err
+	}
+	failure := &common.Failure{WorkerID: config.WorkerID, Phase: phase, Error: err.Error()}
+	if sendErr := connection.Send(common.WorkerMessage{Kind: common.MessageFailure, Failure: failure}); sendErr != nil {
+		return fmt.Errorf("Could not report failure to server: %w", sendErr)
+	}
+	return nil
+}
+
 // PerfTest runs a performance test as configured in testConfig
-func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, workerID string) time.Duration {
+// It waits until the start of the schedule and stops at its end - without
+// a schedule, the test starts immediately and the runtime determines its end.
+// If reportProgress is set, it is called every progressInterval with the
+// intervals that were completed in the meantime.
+// Operations during the warm-up and cool-down of the test are not part of
+// the returned results. When abort is closed, no more work is handed out -
+// the running operations are finished, the cleanup is done and the results
+// until then are returned
+func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, workerID string, schedule common.Schedule, abort <-chan struct{}, reportProgress func([]*common.IntervalStats), progressInterval time.Duration) common.BenchmarkResult {
 	workChannel := make(chan WorkItem, len(*Workqueue.Queue))
 	notifyChan := make(chan struct{})
 	wg := &sync.WaitGroup{}
 	wg.Add(testConfig.ParallelClients)
 
-	startTime := time.Now().UTC()
+	aborted := false
+	if wait := time.Until(schedule.StartAt); wait > 0 {
+		log.WithField("start", schedule.StartAt).Infof("Waiting %s for the scheduled start", wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-abort:
+			aborted = true
+		}
+	}
+	// The phases of the test are calculated from the scheduled start, so
+	// that all workers switch phases at the same time
+	startTime := schedule.StartAt.UTC()
+	if startTime.IsZero() {
+		startTime = time.Now().UTC()
+	}
+	warmupEnd := startTime.Add(time.Duration(testConfig.Warmup))
+	stopTime := schedule.StopAt.UTC()
+	if stopTime.IsZero() {
+		stopTime = warmupEnd.Add(time.Duration(testConfig.Runtime + testConfig.Cooldown))
+	}
+	cooldownStart := stopTime.Add(-time.Duration(testConfig.Cooldown))
+	recorder.start(startTime, time.Duration(testConfig.Timeline.Interval))
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		if reportProgress == nil {
+			return
+		}
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reportProgress(recorder.completed())
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
 	promTestStart.WithLabelValues(testConfig.Name).Set(float64(startTime.UnixNano() / int64(1000000)))
+	// The counters keep the values of previous tests with the same name
+	measureStart, measureStartTime := takePromSnapshot(testConfig.Name), startTime
 	// promTestGauge.WithLabelValues(testConfig.Name).Inc()
 	for worker := 0; worker < testConfig.ParallelClients; worker++ {
 		go DoWork(workChannel, notifyChan, wg)
 	}
 	log.Infof("Started %d parallel clients", testConfig.ParallelClients)
-	if testConfig.Runtime != 0 {
-		workUntilTimeout(Workqueue, workChannel, notifyChan, time.Duration(testConfig.Runtime))
-	} else {
-		workUntilOps(Workqueue, workChannel, testConfig.OpsDeadline, testConfig.ParallelClients)
+	if testConfig.Warmup != 0 && !aborted {
+		aborted = workUntil(Workqueue, workChannel, warmupEnd, abort)
+		measureStart, measureStartTime = takePromSnapshot(testConfig.Name), time.Now().UTC()
+		promWarmupEnd.WithLabelValues(testConfig.Name).Set(float64(measureStartTime.UnixNano() / int64(1000000)))
+		log.Info("Warm-up finished - starting measurements")
+	}
+	var measureEnd promSnapshot
+	var measureEndTime time.Time
+	switch {
+	case aborted:
+	case testConfig.Runtime != 0:
+		aborted = workUntil(Workqueue, workChannel, cooldownStart, abort)
+		log.Debug("Reached Runtime end")
+		if testConfig.Cooldown != 0 && !aborted {
+			measureEnd, measureEndTime = takePromSnapshot(testConfig.Name), time.Now().UTC()
+			promCooldownStart.WithLabelValues(testConfig.Name).Set(float64(measureEndTime.UnixNano() / int64(1000000)))
+			log.Info("Measurements finished - starting cool-down")
+			aborted = workUntil(Workqueue, workChannel, stopTime, abort)
+		}
+	default:
+		aborted = workUntilOps(Workqueue, workChannel, testConfig.OpsDeadline, testConfig.ParallelClients, abort)
+	}
+	if testConfig.Runtime != 0 || aborted {
+		close(notifyChan)
+	}
+	if aborted {
+		log.Warning("Test aborted - waiting for the running operations to finish")
 	}
 	// Wait for all the goroutines to finish
 	wg.Wait()
 	log.Info("All clients finished")
 	endTime := time.Now().UTC()
+	if measureEndTime.IsZero() {
+		measureEnd, measureEndTime = takePromSnapshot(testConfig.Name), endTime
+	}
+	recorder.stop(endTime)
+	close(stopProgress)
+	<-progressDone
+	if reportProgress != nil {
+		// Report the remaining intervals including the last partial one
+		reportProgress(recorder.completed())
+	}
 	promTestEnd.WithLabelValues(testConfig.Name).Set(float64(endTime.UnixNano() / int64(1000000)))
 
 	if testConfig.CleanAfter {
@@ -151,7 +529,7 @@ func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, wo
 			}
 		}
 		for bucket := uint64(0); bucket < testConfig.Buckets.NumberMax; bucket++ {
-			err := deleteBucket(housekeepingSvc, fmt.Sprintf("%s%s%d", workerID, testConfig.BucketPrefix, bucket))
+			err := deleteBucket(fmt.Sprintf("%s%s%d", workerID, testConfig.BucketPrefix, bucket), prepareClients(testConfig))
 			if err != nil {
 				log.WithError(err).Error("Error during bucket deleting - ignoring")
 			}
@@ -160,18 +538,28 @@ func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, wo
 	}
 	// Sleep to ensure Prometheus can still scrape the last information before we restart the worker
 	time.Sleep(10 * time.Second)
-	return endTime.Sub(startTime)
+
+	benchResults := measureEnd.since(measureStart).benchmarkResult(testConfig.Name)
+	benchResults.Duration = measureEndTime.Sub(measureStartTime)
+	if benchResults.Duration > 0 {
+		benchResults.Bandwidth = benchResults.Bytes / benchResults.Duration.Seconds()
+	}
+	benchResults.Aborted = aborted
+	return benchResults
 }
 
-func workUntilTimeout(Workqueue *Workqueue, workChannel chan WorkItem, notifyChan chan<- struct{}, runtime time.Duration) {
-	timer := time.NewTimer(runtime)
+// workUntil hands out the work of the queue to the clients until the
+// deadline. It returns true if it stopped because of an abort
+func workUntil(Workqueue *Workqueue, workChannel chan WorkItem, deadline time.Time, abort <-chan struct{}) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
 	for {
 		for _, work := range *Workqueue.Queue {
 			select {
 			case <-timer.C:
-				log.Debug("Reached Runtime end")
-				close(notifyChan)
-				return
+				return false
+			case <-abort:
+				return true
 			case workChannel <- work:
 			}
 		}
@@ -189,7 +577,10 @@ func workUntilTimeout(Workqueue *Workqueue, workChannel chan WorkItem, notifyCha
 	}
 }
 
-func workUntilOps(Workqueue *Workqueue, workChannel chan WorkItem, maxOps uint64, numberOfWorker int) {
+// workUntilOps hands out maxOps operations to the clients and stops them
+// afterwards. It returns true if it stopped early because of an abort - the
+// clients need to be stopped by the caller then
+func workUntilOps(Workqueue *Workqueue, workChannel chan WorkItem, maxOps uint64, numberOfWorker int, abort <-chan struct{}) bool {
 	currentOps := uint64(0)
 	for {
 		for _, work := range *Workqueue.Queue {
@@ -198,10 +589,14 @@ func workUntilOps(Workqueue *Workqueue, workChannel chan WorkItem, maxOps uint64
 				for worker := 0; worker < numberOfWorker; worker++ {
 					workChannel <- &Stopper{}
 				}
-				return
+				return false
+			}
+			select {
+			case <-abort:
+				return true
+			case workChannel <- work:
 			}
 			currentOps++
-			workChannel <- work
 		}
 		for _, work := range *Workqueue.Queue {
 			switch work.(type) {
@@ -217,8 +612,8 @@ func workUntilOps(Workqueue *Workqueue, workChannel chan WorkItem, maxOps uint64
 	}
 }
 
-func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, workerID string, shareBucketName bool) {
-
+// addOperationValues registers all operations with a weight in the work queue
+func addOperationValues(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue) {
 	if testConfig.ReadWeight > 0 {
 		Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: "read"})
 	}
@@ -234,14 +629,36 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 	if testConfig.DeleteWeight > 0 {
 		Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: "delete"})
 	}
+	if testConfig.OverwriteWeight > 0 {
+		Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: "overwrite"})
+	}
+	weights := metadataWeights(testConfig)
+	for _, kind := range metadataKinds {
+		if weights[kind] > 0 {
+			Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: kind})
+		}
+	}
+	if testConfig.VersionWriteWeight > 0 {
+		Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: "version_write"})
+	}
+	if testConfig.VersionReadWeight > 0 {
+		Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: "version_read"})
+	}
+	if testConfig.VersionDeleteWeight > 0 {
+		Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: "version_delete"})
+	}
+	if testConfig.VersionListWeight > 0 {
+		Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: "version_list"})
+	}
+}
+
+func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, workerID string, shareBucketName bool) error {
+	addOperationValues(testConfig, Workqueue)
 
 	bucketCount := common.EvaluateDistribution(testConfig.Buckets.NumberMin, testConfig.Buckets.NumberMax, &testConfig.Buckets.NumberLast, 1, testConfig.Buckets.NumberDistribution)
 	for bucket := uint64(0); bucket < bucketCount; bucket++ {
-		bucketName := fmt.Sprintf("%s%s%d", workerID, testConfig.BucketPrefix, bucket)
-		if shareBucketName {
-			bucketName = fmt.Sprintf("%s%d", testConfig.BucketPrefix, bucket)
-		}
-		err := createBucket(housekeepingSvc, bucketName)
+		bucketName := testBucketName(testConfig, workerID, shareBucketName, bucket)
+		err := createBucket(housekeepingSvc, bucketName, testConfig.Versioning == common.VersioningEnabled)
 		if err != nil {
 			log.WithError(err).WithField("bucket", bucketName).Error("Error when creating bucket")
 		}
@@ -250,7 +667,7 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 		if testConfig.ExistingReadWeight > 0 {
 			preExistingObjects, err = listObjects(housekeepingSvc, "", bucketName)
 			if err != nil {
-				log.WithError(err).Fatalf("Problems when listing contents of bucket %s", bucketName)
+				return fmt.Errorf("Problems when listing contents of bucket %s: %w", bucketName, err)
 			}
 			preExistingObjectCount = uint64(len(preExistingObjects))
 			log.Debugf("Found %d objects in bucket %s", preExistingObjectCount, bucketName)
@@ -274,7 +691,7 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 				new := &ReadOperation{
 					TestName:                 testConfig.Name,
 					Bucket:                   bucketName,
-					ObjectName:               fmt.Sprintf("%s%s%d", workerID, testConfig.ObjectPrefix, object),
+					ObjectName:               testObjectName(testConfig, workerID, bucket, object),
 					ObjectSize:               objectSize,
 					WorksOnPreexistingObject: false,
 				}
@@ -300,7 +717,7 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 				new := &WriteOperation{
 					TestName:   testConfig.Name,
 					Bucket:     bucketName,
-					ObjectName: fmt.Sprintf("%s%s%d", workerID, testConfig.ObjectPrefix, object),
+					ObjectName: testObjectName(testConfig, workerID, bucket, object),
 					ObjectSize: objectSize,
 				}
 				*Workqueue.Queue = append(*Workqueue.Queue, new)
@@ -309,11 +726,19 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 				if err != nil {
 					log.WithError(err).Error("Could not increase operational Value - ignoring")
 				}
+				objectName := testObjectName(testConfig, workerID, bucket, object)
 				new := &ListOperation{
 					TestName:   testConfig.Name,
 					Bucket:     bucketName,
-					ObjectName: fmt.Sprintf("%s%s%d", workerID, testConfig.ObjectPrefix, object),
+					ObjectName: objectName,
 					ObjectSize: objectSize,
+					Prefix:     listPrefix(testConfig, objectName),
+					Delimiter:  testConfig.List.Delimiter,
+					MaxKeys:    testConfig.List.MaxKeys,
+					Version:    testConfig.List.Version,
+				}
+				if testConfig.List.Mode == common.ListModeDirectory {
+					new.Prefix = directoryPath(testConfig, workerID, object, testConfig.List.PrefixDepth)
 				}
 				*Workqueue.Queue = append(*Workqueue.Queue, new)
 			case "delete":
@@ -324,11 +749,185 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 				new := &DeleteOperation{
 					TestName:   testConfig.Name,
 					Bucket:     bucketName,
-					ObjectName: fmt.Sprintf("%s%s%d", workerID, testConfig.ObjectPrefix, object),
+					ObjectName: testObjectName(testConfig, workerID, bucket, object),
 					ObjectSize: objectSize,
 				}
 				*Workqueue.Queue = append(*Workqueue.Queue, new)
+			case "overwrite":
+				err := IncreaseOperationValue(nextOp, 1/float64(testConfig.OverwriteWeight), Workqueue)
+				if err != nil {
+					log.WithError(err).Error("Could not increase operational Value - ignoring")
+				}
+				new := &OverwriteOperation{
+					TestName:   testConfig.Name,
+					Bucket:     bucketName,
+					ObjectName: testObjectName(testConfig, workerID, bucket, object),
+					ObjectSize: objectSize,
+					SizeChange: testConfig.OverwriteSizeChange,
+				}
+				*Workqueue.Queue = append(*Workqueue.Queue, new)
+			case "put_tagging", "get_tagging", "copy", "put_acl", "get_acl", "head":
+				addMetadataOperation(nextOp, testConfig, Workqueue, bucketName, testObjectName(testConfig, workerID, bucket, object), objectSize, false)
+			case "version_write", "version_read", "version_delete", "version_list":
+				addVersionOperation(nextOp, testConfig, Workqueue, bucketName, testObjectName(testConfig, workerID, bucket, object), objectSize)
 			}
 		}
 	}
+	return nil
+}
+
+// addVersionOperation appends the version operation nextOp on the given
+// object to the work queue
+func addVersionOperation(nextOp string, testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, bucketName string, objectName string, objectSize uint64) {
+	var weight int
+	var new WorkItem
+	switch nextOp {
+	case "version_write":
+		weight = testConfig.VersionWriteWeight
+		new = &VersionWriteOperation{
+			TestName:   testConfig.Name,
+			Bucket:     bucketName,
+			ObjectName: objectName,
+			ObjectSize: objectSize,
+		}
+	case "version_read":
+		weight = testConfig.VersionReadWeight
+		new = &VersionReadOperation{
+			TestName:   testConfig.Name,
+			Bucket:     bucketName,
+			ObjectName: objectName,
+			ObjectSize: objectSize,
+			Versions:   testConfig.VersionsPerObject,
+		}
+	case "version_delete":
+		weight = testConfig.VersionDeleteWeight
+		new = &VersionDeleteOperation{
+			TestName:   testConfig.Name,
+			Bucket:     bucketName,
+			ObjectName: objectName,
+			ObjectSize: objectSize,
+			Versions:   testConfig.VersionsPerObject,
+		}
+	case "version_list":
+		weight = testConfig.VersionListWeight
+		new = &VersionListOperation{
+			TestName:   testConfig.Name,
+			Bucket:     bucketName,
+			ObjectName: objectName,
+			ObjectSize: objectSize,
+			Versions:   testConfig.VersionsPerObject,
+		}
+	default:
+		return
+	}
+	err := IncreaseOperationValue(nextOp, 1/float64(weight), Workqueue)
+	if err != nil {
+		log.WithError(err).Error("Could not increase operational Value - ignoring")
+	}
+	*Workqueue.Queue = append(*Workqueue.Queue, new)
+}
+
+// metadataWeights returns the weights of the metadata operations by kind
+func metadataWeights(testConfig *common.TestCaseConfiguration) map[string]int {
+	return map[string]int{
+		"put_tagging": testConfig.PutTaggingWeight,
+		"get_tagging": testConfig.GetTaggingWeight,
+		"copy":        testConfig.CopyWeight,
+		"put_acl":     testConfig.PutACLWeight,
+		"get_acl":     testConfig.GetACLWeight,
+		"head":        testConfig.HeadWeight,
+	}
+}
+
+// addMetadataOperation appends the metadata operation nextOp on the given
+// object to the work queue
+func addMetadataOperation(nextOp string, testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, bucketName string, objectName string, objectSize uint64, preexisting bool) {
+	err := IncreaseOperationValue(nextOp, 1/float64(metadataWeights(testConfig)[nextOp]), Workqueue)
+	if err != nil {
+		log.WithError(err).Error("Could not increase operational Value - ignoring")
+	}
+	new := &MetadataOperation{
+		TestName:                 testConfig.Name,
+		Bucket:                   bucketName,
+		ObjectName:               objectName,
+		ObjectSize:               objectSize,
+		Kind:                     nextOp,
+		WorksOnPreexistingObject: preexisting,
+	}
+	if nextOp == "put_tagging" {
+		new.Tagging = newTagging(testConfig.TagsPerObject)
+	}
+	*Workqueue.Queue = append(*Workqueue.Queue, new)
+}
+
+// testBucketName returns the name of a bucket of the test
+func testBucketName(testConfig *common.TestCaseConfiguration, workerID string, shareBucketName bool, bucket uint64) string {
+	if shareBucketName {
+		return fmt.Sprintf("%s%d", testConfig.BucketPrefix, bucket)
+	}
+	return fmt.Sprintf("%s%s%d", workerID, testConfig.BucketPrefix, bucket)
+}
+
+// testObjectName returns the name of an object of the test. With a key
+// template, the template names the objects. In list mode directory, the
+// objects are spread over a tree of directories
+func testObjectName(testConfig *common.TestCaseConfiguration, workerID string, bucket uint64, object uint64) string {
+	if testConfig.KeyTemplate.Template != "" {
+		return testConfig.KeyTemplate.Key(workerID, testConfig.ObjectPrefix, bucket, object)
+	}
+	if testConfig.List.Mode == common.ListModeDirectory {
+		return fmt.Sprintf("%s%d", directoryPath(testConfig, workerID, object, testConfig.List.Depth), object)
+	}
+	return fmt.Sprintf("%s%s%d", workerID, testConfig.ObjectPrefix, object)
+}
+
+// directoryPath returns the path of the first levels of directories that
+// contain the given object, ending with the delimiter. Every directory
+// holds fanout subdirectories and the deepest ones fanout objects
+func directoryPath(testConfig *common.TestCaseConfiguration, workerID string, object uint64, levels int) string {
+	list := testConfig.List
+	path := workerID + testConfig.ObjectPrefix + list.Delimiter
+	fanout := uint64(list.Fanout)
+	for level := 0; level < levels; level++ {
+		divisor := uint64(1)
+		for i := level; i < list.Depth; i++ {
+			divisor *= fanout
+		}
+		path += fmt.Sprintf("d%d%s", object/divisor%fanout, list.Delimiter)
+	}
+	return path
+}
+
+// listPrefix returns the prefix that list operations on the given object
+// list in list modes prefix and full
+func listPrefix(testConfig *common.TestCaseConfiguration, objectName string) string {
+	if testConfig.List.Mode == common.ListModeFull {
+		return ""
+	}
+	return objectName
+}
+
+// fillPrepareWorkqueue creates the buckets of the test and returns the
+// uploads of all its objects. The objects are named like the ones of
+// fillWorkqueue, so a later test with mode run finds them
+func fillPrepareWorkqueue(testConfig *common.TestCaseConfiguration, workerID string, shareBucketName bool) []WorkItem {
+	var uploads []WorkItem
+	bucketCount := common.EvaluateDistribution(testConfig.Buckets.NumberMin, testConfig.Buckets.NumberMax, &testConfig.Buckets.NumberLast, 1, testConfig.Buckets.NumberDistribution)
+	for bucket := uint64(0); bucket < bucketCount; bucket++ {
+		bucketName := testBucketName(testConfig, workerID, shareBucketName, bucket)
+		err := createBucket(housekeepingSvc, bucketName, testConfig.Versioning == common.VersioningEnabled)
+		if err != nil {
+			log.WithError(err).WithField("bucket", bucketName).Error("Error when creating bucket")
+		}
+		objectCount := common.EvaluateDistribution(testConfig.Objects.NumberMin, testConfig.Objects.NumberMax, &testConfig.Objects.NumberLast, 1, testConfig.Objects.NumberDistribution)
+		for object := uint64(0); object < objectCount; object++ {
+			objectSize := common.EvaluateDistribution(testConfig.Objects.SizeMin, testConfig.Objects.SizeMax, &testConfig.Objects.SizeLast, 1, testConfig.Objects.SizeDistribution)
+			uploads = append(uploads, &UploadOperation{
+				Bucket:     bucketName,
+				ObjectName: testObjectName(testConfig, workerID, bucket, object),
+				ObjectSize: objectSize,
+			})
+		}
+	}
+	return uploads
 }
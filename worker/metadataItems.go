@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinds of metadata operations and the methods they are reported as
+var metadataMethods = map[string]string{
+	"put_tagging": "PUT_TAG",
+	"get_tagging": "GET_TAG",
+	"copy":        "COPY",
+	"put_acl":     "PUT_ACL",
+	"get_acl":     "GET_ACL",
+	"head":        "HEAD",
+}
+
+// metadataKinds are the keys of metadataMethods in a fixed order, so that
+// every run of a test queues the same operations
+var metadataKinds = []string{"put_tagging", "get_tagging", "copy", "put_acl", "get_acl", "head"}
+
+// MetadataOperation works on the tags, ACL or metadata of a prepared
+// object instead of its data
+type MetadataOperation struct {
+	TestName   string
+	Bucket     string
+	ObjectName string
+	ObjectSize uint64
+	// Kind is one of the keys of metadataMethods
+	Kind string
+	// Tagging is the tag set that put_tagging sets
+	Tagging *types.Tagging
+	// WorksOnPreexistingObject is set for objects that are not prepared
+	// and not cleaned up by the test, e.g. of a dataset
+	WorksOnPreexistingObject bool
+}
+
+// copyName returns the name of the copy that the copy operation creates
+func (op *MetadataOperation) copyName() string {
+	return op.ObjectName + "-copy"
+}
+
+// Prepare prepares the execution of the MetadataOperation
+func (op *MetadataOperation) Prepare() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).WithField("kind", op.Kind).Debug("Preparing MetadataOperation")
+	if op.WorksOnPreexistingObject {
+		return nil
+	}
+	random, err := generateRandomBytes(op.ObjectSize)
+	if err != nil {
+		return err
+	}
+	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(random), op.Bucket)
+}
+
+// Do executes the actual work of the MetadataOperation
+func (op *MetadataOperation) Do() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).WithField("kind", op.Kind).Debug("Doing MetadataOperation")
+	method, ok := metadataMethods[op.Kind]
+	if !ok {
+		return fmt.Errorf("Unknown metadata operation %s", op.Kind)
+	}
+	var copied uint64
+	ep := svcPool.acquire()
+	start := time.Now()
+	var err error
+	switch op.Kind {
+	case "put_tagging":
+		err = putObjectTagging(ep.Client, op.ObjectName, op.Bucket, op.Tagging)
+	case "get_tagging":
+		err = getObjectTagging(ep.Client, op.ObjectName, op.Bucket)
+	case "copy":
+		err = copyObject(ep.Client, op.ObjectName, op.copyName(), op.Bucket)
+		copied = op.ObjectSize
+	case "put_acl":
+		err = putObjectACL(ep.Client, op.ObjectName, op.Bucket)
+	case "get_acl":
+		err = getObjectACL(ep.Client, op.ObjectName, op.Bucket)
+	case "head":
+		_, err = headObject(ep.Client, op.ObjectName, op.Bucket)
+	}
+	duration := time.Since(start)
+	svcPool.release(ep)
+	observeOperation(op.TestName, method, ep, duration, copied, err)
+	if copied > 0 {
+		promUploadedBytes.WithLabelValues(op.TestName, method, ep.Address).Add(float64(copied))
+	}
+	return err
+}
+
+// Clean removes the objects left from the previous MetadataOperation
+func (op *MetadataOperation) Clean() error {
+	if op.Kind == "copy" {
+		if err := deleteObject(housekeepingSvc, op.copyName(), op.Bucket); err != nil {
+			return err
+		}
+	}
+	if op.WorksOnPreexistingObject {
+		return nil
+	}
+	return deleteObject(housekeepingSvc, op.ObjectName, op.Bucket)
+}
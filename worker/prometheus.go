@@ -22,37 +22,85 @@ var promTestEnd = prom.NewGaugeVec(
 		Namespace: "gosbench",
 		Help:      "Determines the end time of a job for Grafana annotations",
 	}, []string{"testName"})
+var promWarmupEnd = prom.NewGaugeVec(
+	prom.GaugeOpts{
+		Name:      "test_warmup_end",
+		Namespace: "gosbench",
+		Help:      "Determines the end of the warm-up of a job for Grafana annotations",
+	}, []string{"testName"})
+var promCooldownStart = prom.NewGaugeVec(
+	prom.GaugeOpts{
+		Name:      "test_cooldown_start",
+		Namespace: "gosbench",
+		Help:      "Determines the start of the cool-down of a job for Grafana annotations",
+	}, []string{"testName"})
+var promPrepObjects = prom.NewGaugeVec(
+	prom.GaugeOpts{
+		Name:      "prepare_objects",
+		Namespace: "gosbench",
+		Help:      "Objects uploaded during the preparation of a job",
+	}, []string{"testName"})
+var promPrepObjectsTotal = prom.NewGaugeVec(
+	prom.GaugeOpts{
+		Name:      "prepare_objects_total",
+		Namespace: "gosbench",
+		Help:      "Objects to upload during the preparation of a job",
+	}, []string{"testName"})
+var promPrepBytes = prom.NewGaugeVec(
+	prom.GaugeOpts{
+		Name:      "prepare_bytes",
+		Namespace: "gosbench",
+		Help:      "Bytes uploaded during the preparation of a job",
+	}, []string{"testName"})
+var promPrepBytesTotal = prom.NewGaugeVec(
+	prom.GaugeOpts{
+		Name:      "prepare_bytes_total",
+		Namespace: "gosbench",
+		Help:      "Bytes to upload during the preparation of a job",
+	}, []string{"testName"})
 var promFinishedOps = prom.NewCounterVec(
 	prom.CounterOpts{
 		Name:      "finished_ops",
 		Namespace: "gosbench",
 		Help:      "Finished S3 operations",
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
 var promFailedOps = prom.NewCounterVec(
 	prom.CounterOpts{
 		Name:      "failed_ops",
 		Namespace: "gosbench",
 		Help:      "Failed S3 operations",
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
 var promLatency = prom.NewHistogramVec(
 	prom.HistogramOpts{
 		Name:      "ops_latency",
 		Namespace: "gosbench",
 		Help:      "Histogram latency of S3 operations",
 		Buckets:   prom.ExponentialBuckets(2, 2, 12),
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
 var promUploadedBytes = prom.NewCounterVec(
 	prom.CounterOpts{
 		Name:      "uploaded_bytes",
 		Namespace: "gosbench",
 		Help:      "Uploaded bytes to S3 store",
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
 var promDownloadedBytes = prom.NewCounterVec(
 	prom.CounterOpts{
 		Name:      "downloaded_bytes",
 		Namespace: "gosbench",
 		Help:      "Downloaded bytes from S3 store",
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
+var promListedKeys = prom.NewCounterVec(
+	prom.CounterOpts{
+		Name:      "listed_keys",
+		Namespace: "gosbench",
+		Help:      "Keys and common prefixes returned by list operations",
+	}, []string{"testName", "method", "endpoint"})
+var promListedPages = prom.NewCounterVec(
+	prom.CounterOpts{
+		Name:      "listed_pages",
+		Namespace: "gosbench",
+		Help:      "Pages returned by list operations",
+	}, []string{"testName", "method", "endpoint"})
 
 func init() {
 	// Then create the prometheus stat exporter
@@ -74,6 +122,24 @@ func init() {
 	if err = promRegistry.Register(promTestEnd); err != nil {
 		log.WithError(err).Error("Issues when adding test_end gauge to Prometheus registry")
 	}
+	if err = promRegistry.Register(promWarmupEnd); err != nil {
+		log.WithError(err).Error("Issues when adding test_warmup_end gauge to Prometheus registry")
+	}
+	if err = promRegistry.Register(promCooldownStart); err != nil {
+		log.WithError(err).Error("Issues when adding test_cooldown_start gauge to Prometheus registry")
+	}
+	if err = promRegistry.Register(promPrepObjects); err != nil {
+		log.WithError(err).Error("Issues when adding prepare_objects gauge to Prometheus registry")
+	}
+	if err = promRegistry.Register(promPrepObjectsTotal); err != nil {
+		log.WithError(err).Error("Issues when adding prepare_objects_total gauge to Prometheus registry")
+	}
+	if err = promRegistry.Register(promPrepBytes); err != nil {
+		log.WithError(err).Error("Issues when adding prepare_bytes gauge to Prometheus registry")
+	}
+	if err = promRegistry.Register(promPrepBytesTotal); err != nil {
+		log.WithError(err).Error("Issues when adding prepare_bytes_total gauge to Prometheus registry")
+	}
 	if err = promRegistry.Register(promFinishedOps); err != nil {
 		log.WithError(err).Error("Issues when adding finished_ops gauge to Prometheus registry")
 	}
@@ -89,12 +155,23 @@ func init() {
 	if err = promRegistry.Register(promDownloadedBytes); err != nil {
 		log.WithError(err).Error("Issues when adding downloaded_bytes gauge to Prometheus registry")
 	}
+	if err = promRegistry.Register(promListedKeys); err != nil {
+		log.WithError(err).Error("Issues when adding listed_keys counter to Prometheus registry")
+	}
+	if err = promRegistry.Register(promListedPages); err != nil {
+		log.WithError(err).Error("Issues when adding listed_pages counter to Prometheus registry")
+	}
 }
 
-func getCurrentPromValues(testName string) common.BenchmarkResult {
-	benchResult := common.BenchmarkResult{
-		TestName: testName,
-	}
+// promSnapshot contains the raw Prometheus values of a test at one point in time
+type promSnapshot struct {
+	operations   float64
+	bytes        float64
+	latencySum   float64
+	latencyCount float64
+}
+
+func takePromSnapshot(testName string) promSnapshot {
 	result, err := promRegistry.Gather()
 	if err != nil {
 		log.WithError(err).Error("ERROR during PROM VALUE gathering")
@@ -103,9 +180,33 @@ func getCurrentPromValues(testName string) common.BenchmarkResult {
 	for _, metric := range result {
 		resultmap[*metric.Name] = metric.Metric
 	}
-	benchResult.Operations = sumCounterForTest(resultmap["gosbench_finished_ops"], testName)
-	benchResult.Bytes = sumCounterForTest(resultmap["gosbench_uploaded_bytes"], testName) + sumCounterForTest(resultmap["gosbench_downloaded_bytes"], testName)
-	benchResult.LatencyAvg = averageHistogramForTest(resultmap["gosbench_ops_latency"], testName)
+	snapshot := promSnapshot{
+		operations: sumCounterForTest(resultmap["gosbench_finished_ops"], testName),
+		bytes:      sumCounterForTest(resultmap["gosbench_uploaded_bytes"], testName) + sumCounterForTest(resultmap["gosbench_downloaded_bytes"], testName),
+	}
+	snapshot.latencySum, snapshot.latencyCount = sumHistogramForTest(resultmap["gosbench_ops_latency"], testName)
+	return snapshot
+}
+
+// since returns the values that were added after the earlier snapshot
+func (s promSnapshot) since(earlier promSnapshot) promSnapshot {
+	return promSnapshot{
+		operations:   s.operations - earlier.operations,
+		bytes:        s.bytes - earlier.bytes,
+		latencySum:   s.latencySum - earlier.latencySum,
+		latencyCount: s.latencyCount - earlier.latencyCount,
+	}
+}
+
+func (s promSnapshot) benchmarkResult(testName string) common.BenchmarkResult {
+	benchResult := common.BenchmarkResult{
+		TestName:   testName,
+		Operations: s.operations,
+		Bytes:      s.bytes,
+	}
+	if s.latencyCount > 0 {
+		benchResult.LatencyAvg = s.latencySum / s.latencyCount
+	}
 	return benchResult
 }
 
@@ -121,7 +222,7 @@ func sumCounterForTest(metrics []*promModel.Metric, testName string) float64 {
 	return sum
 }
 
-func averageHistogramForTest(metrics []*promModel.Metric, testName string) float64 {
+func sumHistogramForTest(metrics []*promModel.Metric, testName string) (float64, float64) {
 	sum := float64(0)
 	count := float64(0)
 	for _, metric := range metrics {
@@ -132,5 +233,5 @@ func averageHistogramForTest(metrics []*promModel.Metric, testName string) float
 			}
 		}
 	}
-	return sum / count
+	return sum, count
 }
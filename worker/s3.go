@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/md5"
 	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	s3config "github.com/aws/aws-sdk-go-v2/config"
@@ -21,10 +26,62 @@ import (
 	"go.opencensus.io/stats/view"
 )
 
-var svc, housekeepingSvc *s3.Client
+var housekeepingSvc *s3.Client
+var svcPool *endpointPool
 var ctx context.Context
 var hc *http.Client
 
+// objectMetadata is attached as user metadata to every uploaded object
+var objectMetadata map[string]string
+
+// objectEncryption is the server-side encryption of every request that
+// reads or writes object data - nil without encryption
+var objectEncryption *encryption
+
+// s3Endpoint is a single S3 endpoint together with the measured client
+// that talks to it and the number of requests currently in flight
+type s3Endpoint struct {
+	Address     string
+	Client      *s3.Client
+	outstanding atomic.Int64
+}
+
+// endpointPool spreads the requests of the parallel clients across all
+// endpoints of the S3 config this worker got assigned
+type endpointPool struct {
+	endpoints []*s3Endpoint
+	strategy  string
+	next      atomic.Uint64
+}
+
+// acquire returns the endpoint that should serve the next request
+// release must be called once the request is finished
+func (p *endpointPool) acquire() *s3Endpoint {
+	var ep *s3Endpoint
+	switch p.strategy {
+	case "random":
+		ep = p.endpoints[rand.Intn(len(p.endpoints))]
+	case "least-outstanding":
+		// Start at a rotating offset so that ties do not always favor the first endpoint
+		offset := p.next.Add(1)
+		for i := range p.endpoints {
+			candidate := p.endpoints[(offset+uint64(i))%uint64(len(p.endpoints))]
+			if ep == nil || candidate.outstanding.Load() < ep.outstanding.Load() {
+				ep = candidate
+			}
+		}
+	default:
+		ep = p.endpoints[(p.next.Add(1)-1)%uint64(len(p.endpoints))]
+	}
+	ep.outstanding.Add(1)
+	return ep
+}
+
+// release marks a request on the given endpoint as finished
+func (p *endpointPool) release(ep *s3Endpoint) {
+	ep.outstanding.Add(-1)
+}
+
 func init() {
 	if err := view.Register([]*view.View{
 		ochttp.ClientSentBytesDistribution,
@@ -49,7 +106,7 @@ func init() {
 
 // InitS3 initialises the S3 session
 // Also starts the Prometheus exporter on Port 8888
-func InitS3(config common.S3Configuration) {
+func InitS3(config common.S3Configuration) error {
 	// All clients require a Session. The Session provides the client with
 	// shared configuration such as region, endpoint, and credentials. A
 	// Session should be shared where possible to take advantage of
@@ -76,7 +133,7 @@ func InitS3(config common.S3Configuration) {
 		}),
 	)
 	if err != nil {
-		log.WithError(err).Fatal("Unable to build S3 config")
+		return fmt.Errorf("Unable to build S3 config: %w", err)
 	}
 	// Use this Session to do things that are hidden from the performance monitoring
 	// Setting up the housekeeping S3 client
@@ -93,46 +150,136 @@ func InitS3(config common.S3Configuration) {
 		}),
 	)
 	if err != nil {
-		log.WithError(err).Fatal("Unable to build S3 housekeeping config")
+		return fmt.Errorf("Unable to build S3 housekeeping config: %w", err)
 	}
 
 	// Create a new instance of the service's client with a Session.
 	// Optional aws.Config values can also be provided as variadic arguments
 	// to the New function. This option allows you to provide service
 	// specific configuration.
-	svc = s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(config.Endpoint)
-		o.UsePathStyle = config.UsePathStyle
-	})
+	// Every endpoint gets its own client - requests are spread across them
+	endpoints := config.EndpointList()
+	svcPool = &endpointPool{strategy: config.LoadBalancing}
+	for _, endpoint := range endpoints {
+		svcPool.endpoints = append(svcPool.endpoints, &s3Endpoint{
+			Address: endpoint,
+			Client: s3.NewFromConfig(cfg, func(o *s3.Options) {
+				o.BaseEndpoint = aws.String(endpoint)
+				o.UsePathStyle = config.UsePathStyle
+			}),
+		})
+	}
 	// Use this service to do things that are hidden from the performance monitoring
 	housekeepingSvc = s3.NewFromConfig(hkCfg, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(config.Endpoint)
+		o.BaseEndpoint = aws.String(endpoints[0])
 		o.UsePathStyle = config.UsePathStyle
 	})
 
-	log.Debug("S3 Init done")
+	log.WithField("endpoints", endpoints).WithField("load_balancing", config.LoadBalancing).Debug("S3 Init done")
+	return nil
+}
+
+// encryption contains the server-side encryption headers of a test
+type encryption struct {
+	mode     types.ServerSideEncryption
+	kmsKeyID *string
+	// algorithm, key and keyMD5 are only set for SSE-C
+	algorithm *string
+	key       *string
+	keyMD5    *string
+}
+
+// newEncryption returns the encryption headers of the given config - nil
+// if the test does not use encryption
+func newEncryption(config common.Encryption) (*encryption, error) {
+	switch config.Mode {
+	case common.EncryptionSSES3:
+		return &encryption{mode: types.ServerSideEncryptionAes256}, nil
+	case common.EncryptionSSEKMS:
+		e := &encryption{mode: types.ServerSideEncryptionAwsKms}
+		if config.KMSKeyID != "" {
+			e.kmsKeyID = aws.String(config.KMSKeyID)
+		}
+		return e, nil
+	case common.EncryptionSSEC:
+		key, err := base64.StdEncoding.DecodeString(config.CustomerKey)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid customer key: %w", err)
+		}
+		sum := md5.Sum(key)
+		return &encryption{
+			algorithm: aws.String(string(types.ServerSideEncryptionAes256)),
+			key:       aws.String(config.CustomerKey),
+			keyMD5:    aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		}, nil
+	}
+	return nil, nil
+}
+
+func (e *encryption) applyPut(input *s3.PutObjectInput) {
+	if e == nil {
+		return
+	}
+	input.ServerSideEncryption = e.mode
+	input.SSEKMSKeyId = e.kmsKeyID
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = e.algorithm, e.key, e.keyMD5
+}
+
+func (e *encryption) applyGet(input *s3.GetObjectInput) {
+	if e == nil {
+		return
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = e.algorithm, e.key, e.keyMD5
+}
+
+func (e *encryption) applyHead(input *s3.HeadObjectInput) {
+	if e == nil {
+		return
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = e.algorithm, e.key, e.keyMD5
+}
+
+// applyCopy encrypts the copy like its source, which SSE-C needs the key for
+func (e *encryption) applyCopy(input *s3.CopyObjectInput) {
+	if e == nil {
+		return
+	}
+	input.ServerSideEncryption = e.mode
+	input.SSEKMSKeyId = e.kmsKeyID
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = e.algorithm, e.key, e.keyMD5
+	input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = e.algorithm, e.key, e.keyMD5
 }
 
 func putObject(service *s3.Client, objectName string, objectContent io.ReadSeeker, bucket string) error {
+	_, err := putObjectVersion(service, objectName, objectContent, bucket)
+	return err
+}
+
+// putObjectVersion uploads an object and returns the ID of the new version
+// - it is empty if the bucket is not versioned
+func putObjectVersion(service *s3.Client, objectName string, objectContent io.ReadSeeker, bucket string) (string, error) {
 	// Create an uploader with S3 client and custom options
 	uploader := manager.NewUploader(service, func(d *manager.Uploader) {
 		d.MaxUploadParts = 1
 	})
 
-	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
-		Bucket: &bucket,
-		Key:    &objectName,
-		Body:   objectContent,
-	})
+	input := &s3.PutObjectInput{
+		Bucket:   &bucket,
+		Key:      &objectName,
+		Body:     objectContent,
+		Metadata: objectMetadata,
+	}
+	objectEncryption.applyPut(input)
+	result, err := uploader.Upload(ctx, input)
 
 	if err != nil {
 		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to upload object,")
-		return err
+		return "", err
 	}
 
 	log.WithField("bucket", bucket).WithField("key", objectName).Tracef("Upload successful")
 
-	return err
+	return aws.ToString(result.VersionID), nil
 }
 
 // func getObjectProperties(service *s3.S3, objectName string, bucket string) {
@@ -175,15 +322,74 @@ func listObjects(service *s3.Client, prefix string, bucket string) ([]types.Obje
 	return bucketContents, nil
 }
 
+// listObjectPages lists all objects with the given prefix page by page
+// without keeping them. It returns the number of listed keys and common
+// prefixes and the number of pages
+func listObjectPages(service *s3.Client, bucket string, prefix string, delimiter string, maxKeys int32, version int) (uint64, uint64, error) {
+	var keys, pages uint64
+	var maxKeysParam *int32
+	if maxKeys > 0 {
+		maxKeysParam = &maxKeys
+	}
+	var delimiterParam *string
+	if delimiter != "" {
+		delimiterParam = &delimiter
+	}
+	if version == 1 {
+		input := &s3.ListObjectsInput{Bucket: &bucket, Prefix: &prefix, Delimiter: delimiterParam, MaxKeys: maxKeysParam}
+		for {
+			page, err := service.ListObjects(ctx, input)
+			if err != nil {
+				return keys, pages, err
+			}
+			pages++
+			keys += uint64(len(page.Contents) + len(page.CommonPrefixes))
+			if !aws.ToBool(page.IsTruncated) {
+				return keys, pages, nil
+			}
+			// NextMarker is only returned together with a delimiter
+			input.Marker = page.NextMarker
+			if input.Marker == nil && len(page.Contents) > 0 {
+				input.Marker = page.Contents[len(page.Contents)-1].Key
+			}
+			if input.Marker == nil {
+				return keys, pages, fmt.Errorf("Listing of bucket %s is truncated without a marker", bucket)
+			}
+		}
+	}
+	p := s3.NewListObjectsV2Paginator(service, &s3.ListObjectsV2Input{Bucket: &bucket, Prefix: &prefix, Delimiter: delimiterParam, MaxKeys: maxKeysParam})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return keys, pages, err
+		}
+		pages++
+		keys += uint64(len(page.Contents) + len(page.CommonPrefixes))
+	}
+	return keys, pages, nil
+}
+
 func getObject(service *s3.Client, objectName string, bucket string, objectSize uint64) error {
-	// Remove the allocation of buffer
-	result, err := service.GetObject(ctx, &s3.GetObjectInput{
+	return getObjectVersion(service, objectName, "", bucket, objectSize)
+}
+
+// getObjectVersion reads the given version of an object - or the current
+// version if versionID is empty
+func getObjectVersion(service *s3.Client, objectName string, versionID string, bucket string, objectSize uint64) error {
+	input := &s3.GetObjectInput{
 		Bucket: &bucket,
 		Key:    &objectName,
-	})
+	}
+	if versionID != "" {
+		input.VersionId = &versionID
+	}
+	objectEncryption.applyGet(input)
+	// Remove the allocation of buffer
+	result, err := service.GetObject(ctx, input)
 	if err != nil {
 		return err
 	}
+	defer result.Body.Close()
 	numBytes, err := io.Copy(io.Discard, result.Body)
 	if err != nil {
 		return err
@@ -194,6 +400,20 @@ func getObject(service *s3.Client, objectName string, bucket string, objectSize
 	return nil
 }
 
+// headObject reads the metadata of an object and returns its size
+func headObject(service *s3.Client, objectName string, bucket string) (int64, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &objectName,
+	}
+	objectEncryption.applyHead(input)
+	result, err := service.HeadObject(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+	return aws.ToInt64(result.ContentLength), nil
+}
+
 func deleteObject(service *s3.Client, objectName string, bucket string) error {
 	_, err := service.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: &bucket,
@@ -205,65 +425,169 @@ func deleteObject(service *s3.Client, objectName string, bucket string) error {
 	return err
 }
 
-func createBucket(service *s3.Client, bucket string) error {
-	// Do not err when the bucket is already there...
-	_, err := service.CreateBucket(ctx, &s3.CreateBucketInput{
+// newMetadata returns count metadata entries with random values of the given size
+func newMetadata(count int, size int) map[string]string {
+	if count == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		metadata[fmt.Sprintf("gosbench-%d", i)] = randomString(size)
+	}
+	return metadata
+}
+
+// newTagging returns count tags with random values
+func newTagging(count int) *types.Tagging {
+	tagging := &types.Tagging{}
+	for i := 0; i < count; i++ {
+		tagging.TagSet = append(tagging.TagSet, types.Tag{
+			Key:   aws.String(fmt.Sprintf("gosbench-%d", i)),
+			Value: aws.String(randomString(16)),
+		})
+	}
+	return tagging
+}
+
+func randomString(length int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	value := make([]byte, length)
+	for i := range value {
+		value[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(value)
+}
+
+func putObjectTagging(service *s3.Client, objectName string, bucket string, tagging *types.Tagging) error {
+	_, err := service.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  &bucket,
+		Key:     &objectName,
+		Tagging: tagging,
+	})
+	return err
+}
+
+func getObjectTagging(service *s3.Client, objectName string, bucket string) error {
+	_, err := service.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
 		Bucket: &bucket,
+		Key:    &objectName,
 	})
-	if err != nil {
-		var bne *types.BucketAlreadyExists
-		// Ignore error if bucket already exists
-		if errors.As(err, &bne) {
-			return nil
-		}
-		log.WithError(err).Errorf("Issues when creating bucket %s", bucket)
+	return err
+}
+
+// copyObject copies an object within its bucket and replaces its metadata
+func copyObject(service *s3.Client, sourceName string, objectName string, bucket string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:            &bucket,
+		Key:               &objectName,
+		CopySource:        aws.String((&url.URL{Path: bucket + "/" + sourceName}).EscapedPath()),
+		MetadataDirective: types.MetadataDirectiveReplace,
+		Metadata:          objectMetadata,
 	}
+	objectEncryption.applyCopy(input)
+	_, err := service.CopyObject(ctx, input)
 	return err
 }
 
-func deleteBucket(service *s3.Client, bucket string) error {
-	// First delete all objects in the bucket
-	input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
+func putObjectACL(service *s3.Client, objectName string, bucket string) error {
+	_, err := service.PutObjectAcl(ctx, &s3.PutObjectAclInput{
+		Bucket: &bucket,
+		Key:    &objectName,
+		ACL:    types.ObjectCannedACLPrivate,
+	})
+	return err
+}
+
+func getObjectACL(service *s3.Client, objectName string, bucket string) error {
+	_, err := service.GetObjectAcl(ctx, &s3.GetObjectAclInput{
+		Bucket: &bucket,
+		Key:    &objectName,
+	})
+	return err
+}
+
+func deleteObjectVersion(service *s3.Client, objectName string, versionID string, bucket string) error {
+	_, err := service.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    &bucket,
+		Key:       &objectName,
+		VersionId: &versionID,
+	})
+	if err != nil {
+		log.WithError(err).Errorf("Could not delete version %s of object %s in bucket %s", versionID, objectName, bucket)
 	}
+	return err
+}
 
-	var bucketContents []types.Object
-	isTruncated := true
-	for isTruncated {
-		result, err := service.ListObjectsV2(ctx, input)
+// listObjectVersions lists all versions and delete markers of the objects
+// with the given prefix
+func listObjectVersions(service *s3.Client, prefix string, bucket string) ([]types.ObjectVersion, []types.DeleteMarkerEntry, error) {
+	var versions []types.ObjectVersion
+	var markers []types.DeleteMarkerEntry
+	p := s3.NewListObjectVersionsPaginator(service, &s3.ListObjectVersionsInput{Bucket: aws.String(bucket), Prefix: aws.String(prefix)})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
 		if err != nil {
-			return err
+			log.WithError(err).WithField("prefix", prefix).WithField("bucket", bucket).Errorf("Failed to list object versions")
+			return nil, nil, err
 		}
-		bucketContents = append(bucketContents, result.Contents...)
-		input.ContinuationToken = result.NextContinuationToken
-		isTruncated = *result.IsTruncated
+		versions = append(versions, page.Versions...)
+		markers = append(markers, page.DeleteMarkers...)
 	}
+	return versions, markers, nil
+}
 
-	if len(bucketContents) > 0 {
-		var objectsToDelete []types.ObjectIdentifier
-		for _, item := range bucketContents {
-			objectsToDelete = append(objectsToDelete, types.ObjectIdentifier{
-				Key: item.Key,
-			})
-		}
+// deleteObjects deletes up to 1000 objects with a single request. It
+// returns the objects that could not be deleted
+func deleteObjects(service *s3.Client, bucket string, objects []types.ObjectIdentifier) ([]types.Error, error) {
+	result, err := service.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &types.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Errors, nil
+}
 
-		deleteObjectsInput := &s3.DeleteObjectsInput{
-			Bucket: aws.String(bucket),
-			Delete: &types.Delete{
-				Objects: objectsToDelete,
-				Quiet:   aws.Bool(true),
-			},
-		}
+func listBuckets(service *s3.Client) ([]string, error) {
+	result, err := service.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+	buckets := make([]string, 0, len(result.Buckets))
+	for _, bucket := range result.Buckets {
+		buckets = append(buckets, *bucket.Name)
+	}
+	return buckets, nil
+}
 
-		_, err := svc.DeleteObjects(ctx, deleteObjectsInput)
-		if err != nil {
+func createBucket(service *s3.Client, bucket string, versioning bool) error {
+	// Do not err when the bucket is already there...
+	_, err := service.CreateBucket(ctx, &s3.CreateBucketInput{
+		Bucket: &bucket,
+	})
+	if err != nil {
+		var bne *types.BucketAlreadyExists
+		// Ignore error if bucket already exists
+		if !errors.As(err, &bne) {
+			log.WithError(err).Errorf("Issues when creating bucket %s", bucket)
 			return err
 		}
 	}
-
-	// Then delete the (now empty) bucket itself
-	_, err := service.DeleteBucket(ctx, &s3.DeleteBucketInput{
+	if !versioning {
+		return nil
+	}
+	_, err = service.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
 		Bucket: &bucket,
+		VersioningConfiguration: &types.VersioningConfiguration{
+			Status: types.BucketVersioningStatusEnabled,
+		},
 	})
+	if err != nil {
+		log.WithError(err).Errorf("Issues when enabling versioning on bucket %s", bucket)
+	}
 	return err
 }
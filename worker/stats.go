@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// statsRecorder collects the measurements of the running test in fixed
+// intervals. Completed intervals are streamed to the server and the whole
+// timeline is part of the benchmark result
+type statsRecorder struct {
+	mu        sync.Mutex
+	begin     time.Time
+	end       time.Time
+	interval  time.Duration
+	intervals map[int]*common.IntervalStats
+	// created is the number of intervals that exist so far
+	created int
+	// reported is the index of the first interval that was not yet reported
+	reported int
+}
+
+var recorder = &statsRecorder{}
+
+// start begins a new test - all previous measurements are dropped
+func (r *statsRecorder) start(now time.Time, interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if interval <= 0 {
+		interval = time.Second
+	}
+	r.begin = now
+	r.end = time.Time{}
+	r.interval = interval
+	r.intervals = map[int]*common.IntervalStats{}
+	r.created = 0
+	r.reported = 0
+}
+
+// stop ends the test - operations finishing afterwards are ignored
+func (r *statsRecorder) stop(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.end = now
+	index := r.indexAt(now)
+	last := r.get(index)
+	last.Duration = now.Sub(last.Start)
+	if last.Duration == 0 && index > 0 {
+		// The test ended exactly at an interval boundary
+		delete(r.intervals, index)
+		r.created--
+	}
+}
+
+// record adds a single operation to the current interval
+func (r *statsRecorder) record(method string, duration time.Duration, bytes uint64, err error) {
+	r.observe(method, duration, err, func(stats *common.MethodStats) {
+		stats.Bytes += bytes
+	})
+}
+
+// recordList adds a single list operation with the number of listed keys
+// and pages to the current interval
+func (r *statsRecorder) recordList(method string, duration time.Duration, keys uint64, pages uint64, err error) {
+	r.observe(method, duration, err, func(stats *common.MethodStats) {
+		stats.Keys += keys
+		stats.Pages += pages
+	})
+}
+
+func (r *statsRecorder) observe(method string, duration time.Duration, err error, update func(stats *common.MethodStats)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.intervals == nil || !r.end.IsZero() {
+		return
+	}
+	interval := r.get(r.indexAt(now))
+	stats, ok := interval.Methods[method]
+	if !ok {
+		stats = &common.MethodStats{}
+		interval.Methods[method] = stats
+	}
+	if err != nil {
+		stats.Errors++
+	} else {
+		stats.Operations++
+	}
+	update(stats)
+	stats.Latency.Observe(float64(duration) / float64(time.Millisecond))
+}
+
+// completed returns all intervals that were completed since the last call.
+// Intervals without any operation are included, so that stalls are visible
+func (r *statsRecorder) completed() []*common.IntervalStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.intervals == nil {
+		return nil
+	}
+	var current int
+	if r.end.IsZero() {
+		current = r.indexAt(time.Now())
+	} else {
+		current = r.created
+	}
+	var result []*common.IntervalStats
+	for ; r.reported < current; r.reported++ {
+		result = append(result, r.get(r.reported))
+	}
+	return result
+}
+
+// timeline returns all intervals of the test ordered by time
+func (r *statsRecorder) timeline() []*common.IntervalStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]*common.IntervalStats, 0, len(r.intervals))
+	for _, interval := range r.intervals {
+		result = append(result, interval)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Index < result[j].Index
+	})
+	return result
+}
+
+func (r *statsRecorder) indexAt(now time.Time) int {
+	if now.Before(r.begin) {
+		return 0
+	}
+	return int(now.Sub(r.begin) / r.interval)
+}
+
+// get returns the interval with the given index - missing intervals up to
+// this index are created, so that the timeline has no gaps
+func (r *statsRecorder) get(index int) *common.IntervalStats {
+	for ; r.created <= index; r.created++ {
+		r.intervals[r.created] = &common.IntervalStats{
+			Index:    r.created,
+			Start:    r.begin.Add(time.Duration(r.created) * r.interval),
+			Duration: r.interval,
+			Methods:  map[string]*common.MethodStats{},
+		}
+	}
+	return r.intervals[index]
+}
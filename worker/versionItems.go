@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// VersionWriteOperation overwrites the same object again and again, so
+// every write adds a version to the version chain of the object
+type VersionWriteOperation struct {
+	TestName   string
+	Bucket     string
+	ObjectName string
+	ObjectSize uint64
+}
+
+// VersionReadOperation reads specific versions of an object
+type VersionReadOperation struct {
+	TestName   string
+	Bucket     string
+	ObjectName string
+	ObjectSize uint64
+	Versions   int
+	// VersionIDs are the versions uploaded during the preparation
+	VersionIDs []string
+}
+
+// VersionDeleteOperation permanently deletes the oldest version of an
+// object and uploads a new version in its place
+type VersionDeleteOperation struct {
+	TestName   string
+	Bucket     string
+	ObjectName string
+	ObjectSize uint64
+	Versions   int
+	// VersionIDs are the versions that were not deleted yet, oldest first
+	VersionIDs []string
+	// mu guards VersionIDs - the operation can be queued to several clients
+	// at once
+	mu sync.Mutex
+}
+
+// VersionListOperation lists all versions of an object
+type VersionListOperation struct {
+	TestName   string
+	Bucket     string
+	ObjectName string
+	ObjectSize uint64
+	Versions   int
+}
+
+// prepareVersions uploads the given number of versions of an object and
+// returns their IDs, oldest first
+func prepareVersions(bucket string, objectName string, objectSize uint64, versions int) ([]string, error) {
+	versionIDs := make([]string, 0, versions)
+	for version := 0; version < versions; version++ {
+		random, err := generateRandomBytes(objectSize)
+		if err != nil {
+			return nil, err
+		}
+		versionID, err := putObjectVersion(housekeepingSvc, objectName, bytes.NewReader(random), bucket)
+		if err != nil {
+			return nil, err
+		}
+		if versionID == "" {
+			return nil, fmt.Errorf("Bucket %s did not return a version ID - is versioning enabled?", bucket)
+		}
+		versionIDs = append(versionIDs, versionID)
+	}
+	return versionIDs, nil
+}
+
+// cleanVersions deletes all versions and delete markers of an object
+func cleanVersions(bucket string, objectName string) error {
+	versions, markers, err := listObjectVersions(housekeepingSvc, objectName, bucket)
+	if err != nil {
+		return err
+	}
+	var identifiers []types.ObjectIdentifier
+	for _, version := range versions {
+		if *version.Key == objectName {
+			identifiers = append(identifiers, types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+	}
+	for _, marker := range markers {
+		if *marker.Key == objectName {
+			identifiers = append(identifiers, types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+	}
+	for len(identifiers) > 0 {
+		batch := identifiers[:min(len(identifiers), cleanupBatchSize)]
+		identifiers = identifiers[len(batch):]
+		errs, err := deleteObjects(housekeepingSvc, bucket, batch)
+		if err != nil {
+			return err
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("Could not delete %d versions of object %s in bucket %s", len(errs), objectName, bucket)
+		}
+	}
+	return nil
+}
+
+// Prepare does nothing here - the first write creates the object
+func (op *VersionWriteOperation) Prepare() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing VersionWriteOperation")
+	return nil
+}
+
+// Prepare uploads the versions of the VersionReadOperation
+func (op *VersionReadOperation) Prepare() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing VersionReadOperation")
+	versionIDs, err := prepareVersions(op.Bucket, op.ObjectName, op.ObjectSize, op.Versions)
+	op.VersionIDs = versionIDs
+	return err
+}
+
+// Prepare uploads the versions of the VersionDeleteOperation. Do replaces
+// every version it deletes, so it does not need to be prepared again
+func (op *VersionDeleteOperation) Prepare() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing VersionDeleteOperation")
+	versionIDs, err := prepareVersions(op.Bucket, op.ObjectName, op.ObjectSize, op.Versions)
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.VersionIDs = versionIDs
+	return err
+}
+
+// Prepare uploads the versions of the VersionListOperation
+func (op *VersionListOperation) Prepare() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing VersionListOperation")
+	_, err := prepareVersions(op.Bucket, op.ObjectName, op.ObjectSize, op.Versions)
+	return err
+}
+
+// Do executes the actual work of the VersionWriteOperation
+func (op *VersionWriteOperation) Do() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing VersionWriteOperation")
+	random, err := generateRandomBytes(op.ObjectSize)
+	if err != nil {
+		return err
+	}
+	ep := svcPool.acquire()
+	start := time.Now()
+	_, err = putObjectVersion(ep.Client, op.ObjectName, bytes.NewReader(random), op.Bucket)
+	duration := time.Since(start)
+	svcPool.release(ep)
+	observeOperation(op.TestName, "PUT_VER", ep, duration, op.ObjectSize, err)
+	promUploadedBytes.WithLabelValues(op.TestName, "PUT_VER", ep.Address).Add(float64(op.ObjectSize))
+	return err
+}
+
+// Do executes the actual work of the VersionReadOperation
+func (op *VersionReadOperation) Do() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing VersionReadOperation")
+	if len(op.VersionIDs) == 0 {
+		return fmt.Errorf("Object %s in bucket %s has no prepared versions", op.ObjectName, op.Bucket)
+	}
+	versionID := op.VersionIDs[rand.Intn(len(op.VersionIDs))]
+	ep := svcPool.acquire()
+	start := time.Now()
+	err := getObjectVersion(ep.Client, op.ObjectName, versionID, op.Bucket, op.ObjectSize)
+	duration := time.Since(start)
+	svcPool.release(ep)
+	observeOperation(op.TestName, "GET_VER", ep, duration, op.ObjectSize, err)
+	promDownloadedBytes.WithLabelValues(op.TestName, "GET_VER", ep.Address).Add(float64(op.ObjectSize))
+	return err
+}
+
+// Do executes the actual work of the VersionDeleteOperation. The deleted
+// version is replaced afterwards, outside of the measured time
+func (op *VersionDeleteOperation) Do() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing VersionDeleteOperation")
+	op.mu.Lock()
+	if len(op.VersionIDs) == 0 {
+		op.mu.Unlock()
+		return fmt.Errorf("Object %s in bucket %s has no prepared versions", op.ObjectName, op.Bucket)
+	}
+	versionID := op.VersionIDs[0]
+	op.VersionIDs = op.VersionIDs[1:]
+	op.mu.Unlock()
+
+	ep := svcPool.acquire()
+	start := time.Now()
+	err := deleteObjectVersion(ep.Client, op.ObjectName, versionID, op.Bucket)
+	duration := time.Since(start)
+	svcPool.release(ep)
+	observeOperation(op.TestName, "DELETE_VER", ep, duration, 0, err)
+
+	replacement, prepErr := prepareVersions(op.Bucket, op.ObjectName, op.ObjectSize, 1)
+	if prepErr != nil {
+		log.WithError(prepErr).WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Error("Could not replace the deleted version")
+	}
+	op.mu.Lock()
+	op.VersionIDs = append(op.VersionIDs, replacement...)
+	op.mu.Unlock()
+	return err
+}
+
+// Do executes the actual work of the VersionListOperation
+func (op *VersionListOperation) Do() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing VersionListOperation")
+	ep := svcPool.acquire()
+	start := time.Now()
+	_, _, err := listObjectVersions(ep.Client, op.ObjectName, op.Bucket)
+	duration := time.Since(start)
+	svcPool.release(ep)
+	observeOperation(op.TestName, "LIST_VER", ep, duration, 0, err)
+	return err
+}
+
+// Clean removes all versions of the object of the VersionWriteOperation
+func (op *VersionWriteOperation) Clean() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Cleaning up VersionWriteOperation")
+	return cleanVersions(op.Bucket, op.ObjectName)
+}
+
+// Clean removes all versions of the object of the VersionReadOperation
+func (op *VersionReadOperation) Clean() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Cleaning up VersionReadOperation")
+	return cleanVersions(op.Bucket, op.ObjectName)
+}
+
+// Clean removes all versions of the object of the VersionDeleteOperation
+func (op *VersionDeleteOperation) Clean() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Cleaning up VersionDeleteOperation")
+	return cleanVersions(op.Bucket, op.ObjectName)
+}
+
+// Clean removes all versions of the object of the VersionListOperation
+func (op *VersionListOperation) Clean() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Cleaning up VersionListOperation")
+	return cleanVersions(op.Bucket, op.ObjectName)
+}
@@ -42,6 +42,13 @@ type ListOperation struct {
 	Bucket     string
 	ObjectName string
 	ObjectSize uint64
+	// Prefix is the prefix of the listing - empty lists the whole bucket
+	Prefix    string
+	Delimiter string
+	// MaxKeys is the page size - 0 uses the default of the server
+	MaxKeys int32
+	// Version selects ListObjects (1) or ListObjectsV2 (2)
+	Version int
 }
 
 // DeleteOperation stands for a delete operation
@@ -52,6 +59,27 @@ type DeleteOperation struct {
 	ObjectSize uint64
 }
 
+// OverwriteOperation rewrites a prepared object in place
+type OverwriteOperation struct {
+	TestName   string
+	Bucket     string
+	ObjectName string
+	ObjectSize uint64
+	// SizeChange is the maximum relative size change of every overwrite
+	SizeChange float64
+	// WorksOnPreexistingObject is set for objects that are not prepared
+	// and not cleaned up by the test, e.g. of a dataset
+	WorksOnPreexistingObject bool
+}
+
+// UploadOperation uploads an object of a dataset during the preparation.
+// It is not part of the test itself
+type UploadOperation struct {
+	Bucket     string
+	ObjectName string
+	ObjectSize uint64
+}
+
 // Stopper marks the end of a workqueue when using
 // maxOps as testCase end criterium
 type Stopper struct{}
@@ -96,7 +124,11 @@ func (op *ReadOperation) Prepare() error {
 	if op.WorksOnPreexistingObject {
 		return nil
 	}
-	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(generateRandomBytes(op.ObjectSize)), op.Bucket)
+	random, err := generateRandomBytes(op.ObjectSize)
+	if err != nil {
+		return err
+	}
+	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(random), op.Bucket)
 }
 
 // Prepare prepares the execution of the WriteOperation
@@ -108,13 +140,80 @@ func (op *WriteOperation) Prepare() error {
 // Prepare prepares the execution of the ListOperation
 func (op *ListOperation) Prepare() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing ListOperation")
-	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(generateRandomBytes(op.ObjectSize)), op.Bucket)
+	random, err := generateRandomBytes(op.ObjectSize)
+	if err != nil {
+		return err
+	}
+	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(random), op.Bucket)
 }
 
 // Prepare prepares the execution of the DeleteOperation
 func (op *DeleteOperation) Prepare() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing DeleteOperation")
-	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(generateRandomBytes(op.ObjectSize)), op.Bucket)
+	random, err := generateRandomBytes(op.ObjectSize)
+	if err != nil {
+		return err
+	}
+	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(random), op.Bucket)
+}
+
+// Prepare prepares the execution of the OverwriteOperation
+func (op *OverwriteOperation) Prepare() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing OverwriteOperation")
+	if op.WorksOnPreexistingObject {
+		return nil
+	}
+	random, err := generateRandomBytes(op.ObjectSize)
+	if err != nil {
+		return err
+	}
+	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(random), op.Bucket)
+}
+
+// preparedObject returns the size of the object the work item uploads in
+// its preparation and false if it does not upload anything
+func preparedObject(work WorkItem) (uint64, bool) {
+	switch op := work.(type) {
+	case *ReadOperation:
+		return op.ObjectSize, !op.WorksOnPreexistingObject
+	case *ListOperation:
+		return op.ObjectSize, true
+	case *DeleteOperation:
+		return op.ObjectSize, true
+	case *UploadOperation:
+		return op.ObjectSize, true
+	case *OverwriteOperation:
+		return op.ObjectSize, !op.WorksOnPreexistingObject
+	case *MetadataOperation:
+		return op.ObjectSize, !op.WorksOnPreexistingObject
+	case *VersionReadOperation:
+		return op.ObjectSize * uint64(op.Versions), true
+	case *VersionDeleteOperation:
+		return op.ObjectSize * uint64(op.Versions), true
+	case *VersionListOperation:
+		return op.ObjectSize * uint64(op.Versions), true
+	}
+	return 0, false
+}
+
+// Prepare uploads the object of the dataset
+func (op *UploadOperation) Prepare() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing UploadOperation")
+	random, err := generateRandomBytes(op.ObjectSize)
+	if err != nil {
+		return err
+	}
+	return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(random), op.Bucket)
+}
+
+// Do does nothing here - the upload is part of the preparation
+func (op *UploadOperation) Do() error {
+	return nil
+}
+
+// Clean does nothing here - datasets are kept for later tests
+func (op *UploadOperation) Clean() error {
+	return nil
 }
 
 // Prepare does nothing here
@@ -125,65 +224,104 @@ func (op *Stopper) Prepare() error {
 // Do executes the actual work of the ReadOperation
 func (op *ReadOperation) Do() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).WithField("Preexisting?", op.WorksOnPreexistingObject).Debug("Doing ReadOperation")
+	ep := svcPool.acquire()
 	start := time.Now()
-	err := getObject(svc, op.ObjectName, op.Bucket, op.ObjectSize)
+	err := getObject(ep.Client, op.ObjectName, op.Bucket, op.ObjectSize)
 	duration := time.Since(start)
-	promLatency.WithLabelValues(op.TestName, "GET").Observe(float64(duration.Milliseconds()))
-	if err != nil {
-		promFailedOps.WithLabelValues(op.TestName, "GET").Inc()
-	} else {
-		promFinishedOps.WithLabelValues(op.TestName, "GET").Inc()
-	}
-	promDownloadedBytes.WithLabelValues(op.TestName, "GET").Add(float64(op.ObjectSize))
+	svcPool.release(ep)
+	observeOperation(op.TestName, "GET", ep, duration, op.ObjectSize, err)
+	promDownloadedBytes.WithLabelValues(op.TestName, "GET", ep.Address).Add(float64(op.ObjectSize))
 	return err
 }
 
 // Do executes the actual work of the WriteOperation
 func (op *WriteOperation) Do() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing WriteOperation")
-	start := time.Now()
-	err := putObject(svc, op.ObjectName, bytes.NewReader(generateRandomBytes(op.ObjectSize)), op.Bucket)
-	duration := time.Since(start)
-	promLatency.WithLabelValues(op.TestName, "PUT").Observe(float64(duration.Milliseconds()))
+	random, err := generateRandomBytes(op.ObjectSize)
 	if err != nil {
-		promFailedOps.WithLabelValues(op.TestName, "PUT").Inc()
-	} else {
-		promFinishedOps.WithLabelValues(op.TestName, "PUT").Inc()
+		return err
 	}
-	promUploadedBytes.WithLabelValues(op.TestName, "PUT").Add(float64(op.ObjectSize))
+	ep := svcPool.acquire()
+	start := time.Now()
+	err = putObject(ep.Client, op.ObjectName, bytes.NewReader(random), op.Bucket)
+	duration := time.Since(start)
+	svcPool.release(ep)
+	observeOperation(op.TestName, "PUT", ep, duration, op.ObjectSize, err)
+	promUploadedBytes.WithLabelValues(op.TestName, "PUT", ep.Address).Add(float64(op.ObjectSize))
 	return err
 }
 
 // Do executes the actual work of the ListOperation
 func (op *ListOperation) Do() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing ListOperation")
+	ep := svcPool.acquire()
 	start := time.Now()
-	_, err := listObjects(svc, op.ObjectName, op.Bucket)
+	keys, pages, err := listObjectPages(ep.Client, op.Bucket, op.Prefix, op.Delimiter, op.MaxKeys, op.Version)
 	duration := time.Since(start)
-	promLatency.WithLabelValues(op.TestName, "LIST").Observe(float64(duration.Milliseconds()))
-	if err != nil {
-		promFailedOps.WithLabelValues(op.TestName, "LIST").Inc()
-	} else {
-		promFinishedOps.WithLabelValues(op.TestName, "LIST").Inc()
-	}
+	svcPool.release(ep)
+	observeList(op.TestName, "LIST", ep, duration, keys, pages, err)
 	return err
 }
 
 // Do executes the actual work of the DeleteOperation
 func (op *DeleteOperation) Do() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing DeleteOperation")
+	ep := svcPool.acquire()
 	start := time.Now()
-	err := deleteObject(svc, op.ObjectName, op.Bucket)
+	err := deleteObject(ep.Client, op.ObjectName, op.Bucket)
 	duration := time.Since(start)
-	promLatency.WithLabelValues(op.TestName, "DELETE").Observe(float64(duration.Milliseconds()))
+	svcPool.release(ep)
+	observeOperation(op.TestName, "DELETE", ep, duration, 0, err)
+	return err
+}
+
+// Do executes the actual work of the OverwriteOperation
+func (op *OverwriteOperation) Do() error {
+	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing OverwriteOperation")
+	size := op.ObjectSize
+	if op.SizeChange != 0 {
+		size = uint64(float64(op.ObjectSize) * (1 + (2*rand.Float64()-1)*op.SizeChange))
+	}
+	random, err := generateRandomBytes(size)
 	if err != nil {
-		promFailedOps.WithLabelValues(op.TestName, "DELETE").Inc()
-	} else {
-		promFinishedOps.WithLabelValues(op.TestName, "DELETE").Inc()
+		return err
 	}
+	ep := svcPool.acquire()
+	start := time.Now()
+	err = putObject(ep.Client, op.ObjectName, bytes.NewReader(random), op.Bucket)
+	duration := time.Since(start)
+	svcPool.release(ep)
+	observeOperation(op.TestName, "OVERWRITE", ep, duration, size, err)
+	promUploadedBytes.WithLabelValues(op.TestName, "OVERWRITE", ep.Address).Add(float64(size))
 	return err
 }
 
+// observeOperation updates the Prometheus latency and operation counters
+// of a finished operation and records it for the progress reports
+func observeOperation(testName string, method string, ep *s3Endpoint, duration time.Duration, bytes uint64, err error) {
+	promLatency.WithLabelValues(testName, method, ep.Address).Observe(float64(duration.Milliseconds()))
+	if err != nil {
+		promFailedOps.WithLabelValues(testName, method, ep.Address).Inc()
+	} else {
+		promFinishedOps.WithLabelValues(testName, method, ep.Address).Inc()
+	}
+	recorder.record(method, duration, bytes, err)
+}
+
+// observeList works like observeOperation for list operations and also
+// counts the listed keys and pages
+func observeList(testName string, method string, ep *s3Endpoint, duration time.Duration, keys uint64, pages uint64, err error) {
+	promLatency.WithLabelValues(testName, method, ep.Address).Observe(float64(duration.Milliseconds()))
+	if err != nil {
+		promFailedOps.WithLabelValues(testName, method, ep.Address).Inc()
+	} else {
+		promFinishedOps.WithLabelValues(testName, method, ep.Address).Inc()
+	}
+	promListedKeys.WithLabelValues(testName, method, ep.Address).Add(float64(keys))
+	promListedPages.WithLabelValues(testName, method, ep.Address).Add(float64(pages))
+	recorder.recordList(method, duration, keys, pages, err)
+}
+
 // Do does nothing here
 func (op *Stopper) Do() error {
 	return nil
@@ -213,6 +351,14 @@ func (op *DeleteOperation) Clean() error {
 	return nil
 }
 
+// Clean removes the objects and buckets left from the previous OverwriteOperation
+func (op *OverwriteOperation) Clean() error {
+	if op.WorksOnPreexistingObject {
+		return nil
+	}
+	return deleteObject(housekeepingSvc, op.ObjectName, op.Bucket)
+}
+
 // Clean does nothing here
 func (op *Stopper) Clean() error {
 	return nil
@@ -241,13 +387,13 @@ func DoWork(workChannel <-chan WorkItem, notifyChan <-chan struct{}, wg *sync.Wa
 	}
 }
 
-func generateRandomBytes(size uint64) []byte {
+func generateRandomBytes(size uint64) ([]byte, error) {
 	now := time.Now()
 	random := make([]byte, size)
 	n, err := rand.Read(random)
 	if err != nil {
-		log.WithError(err).Fatal("I had issues getting my random bytes initialized")
+		return nil, fmt.Errorf("I had issues getting my random bytes initialized: %w", err)
 	}
 	log.Tracef("Generated %d random bytes in %v", n, time.Since(now))
-	return random
+	return random, nil
 }